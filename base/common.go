@@ -4,10 +4,116 @@ const (
 	SUCCESS   = "success"
 	INTERRUPT = "interrupt"
 	FAILURE   = "failure"
+	NOT_EXIST = "not exist"
+	TIMEOUT   = "timeout"
+	SKIPPED   = "skipped"
+	DISABLED  = "disabled"
+	// LOCKED reports a run skipped because another run held its lock.
+	LOCKED = "skipped: locked"
+	// QUEUE_FULL reports a run rejected because its queue had no room left.
+	QUEUE_FULL = "rejected: queue full"
+	// RATE_LIMITED reports a run refused by a rate limit; the reply says when
+	// to retry.
+	RATE_LIMITED = "rate_limited"
+	// ABANDONED reports a run given up on by a forced stop while its handler
+	// was still running.
+	ABANDONED = "abandoned"
+	// NOT_STOPPABLE reports a stop refused because the job's handler has no
+	// way to be told to stop.
+	NOT_STOPPABLE = "not_stoppable"
 )
 
 const (
 	RunSignature  = "run_signature"
 	StopSignature = "stop_signature"
 	StopJobFlag   = "stop_job"
+	// ResumeRun carries the signature of an earlier run to resume.
+	ResumeRun = "resume_run"
+	// RunPriority orders a run in its job's queue; higher runs first.
+	RunPriority = "run_priority"
+	// CallerToken identifies the caller for per-caller rate limits.
+	CallerToken = "caller_token"
+	// IdempotencyKey deduplicates retried runs; it defaults to the run
+	// signature.
+	IdempotencyKey = "idempotency_key"
+	// StopWait is how long a stop request waits for the run to exit, as a
+	// duration such as "30s".
+	StopWait = "stop_wait"
+	// StopForce abandons runs that have not exited when a stop stops waiting.
+	StopForce = "stop_force"
+	// StopReason says why a run is stopped; the handler and the run's
+	// history record get it.
+	StopReason = "stop_reason"
+)
+
+// JSONContentType is sent in Accept by clients that understand Response.
+const JSONContentType = "application/json"
+
+// AdminPathPrefix is reserved for built-in endpoints and never routed to jobs.
+const AdminPathPrefix = "/" + ReservedNamespace + "/"
+
+// ReservedNamespace cannot be used as the first segment of a job name.
+const ReservedNamespace = "_saturn"
+
+// NamespaceSeparator joins the namespaces and the name of a job, as in
+// billing.reindex. In request paths a slash may be used instead.
+const NamespaceSeparator = "."
+
+const (
+	JobsPath    = AdminPathPrefix + "jobs"
+	BatchPath   = AdminPathPrefix + "batch"
+	HistoryPath = AdminPathPrefix + "history"
+	EventsPath  = AdminPathPrefix + "events"
+	RunsPath    = AdminPathPrefix + "runs"
+	PausePath   = AdminPathPrefix + "pause"
+	ResumePath  = AdminPathPrefix + "resume"
+	DisablePath = AdminPathPrefix + "disable"
+	EnablePath  = AdminPathPrefix + "enable"
+	StopPath    = AdminPathPrefix + "stop"
+	QueuePath   = AdminPathPrefix + "queue"
+)
+
+// Run states reported on RunsPath and in replies to stop requests.
+const (
+	RunRunning = "running"
+	RunPaused  = "paused"
+	// RunQueued is a run waiting for a worker of its job's queue.
+	RunQueued = "queued"
+	// RunStopping is a run asked to stop whose handler has not returned yet.
+	RunStopping = "stopping"
+	// RunStopped is a run whose handler returned after a stop request.
+	RunStopped = "stopped"
+	// RunUnresponsive is a run that did not exit within the stop's wait.
+	RunUnresponsive = "unresponsive"
+	// RunAbandoned is a run given up on by a forced stop.
+	RunAbandoned = "abandoned"
+)
+
+// Event types published on a registry's event bus.
+const (
+	EventStarted       = "started"
+	EventProgress      = "progress"
+	EventSucceeded     = "succeeded"
+	EventFailed        = "failed"
+	EventInterrupted   = "interrupted"
+	EventTimedOut      = "timed_out"
+	EventStopRequested = "stop_requested"
+	EventPaused        = "paused"
+	EventResumed       = "resumed"
+	EventDisabled      = "disabled"
+	EventEnabled       = "enabled"
+	EventSkipped       = "skipped"
+	EventQueued        = "queued"
+	EventAbandoned     = "abandoned"
+	// EventDropped stands in for events an event stream dropped because its
+	// reader fell behind.
+	EventDropped = "dropped"
+)
+
+// Result types describe how Response.Result is encoded: a JSON document,
+// a JSON string holding text, or a JSON string holding base64 bytes.
+const (
+	ResultJSON  = "json"
+	ResultText  = "text"
+	ResultBytes = "bytes"
 )
@@ -0,0 +1,141 @@
+package base
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ParamInfo describes a parameter key declared by a job at registration time.
+type ParamInfo struct {
+	Name   string   `json:"name"`
+	Values []string `json:"values,omitempty"`
+}
+
+// JobInfo is the discovery view of a registered job served on JobsPath.
+type JobInfo struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Owner       string   `json:"owner,omitempty"`
+	Deprecated  string   `json:"deprecated,omitempty"`
+	Hidden      bool     `json:"hidden,omitempty"`
+	// Disabled holds the reason a disabled job rejects runs.
+	Disabled  string      `json:"disabled,omitempty"`
+	Stoppable bool        `json:"stoppable"`
+	Params    []ParamInfo `json:"params,omitempty"`
+	Running   []string    `json:"running,omitempty"`
+	// Queue is the queue class runs of the job wait in, empty when they
+	// start at once.
+	Queue string `json:"queue,omitempty"`
+}
+
+// RunInfo describes a run in flight, as served on RunsPath.
+type RunInfo struct {
+	Job       string    `json:"job"`
+	Signature string    `json:"signature"`
+	State     string    `json:"state"`
+	Pausable  bool      `json:"pausable"`
+	StartedAt time.Time `json:"started_at"`
+	// Stoppable is false for runs of plain JobHandler jobs, which are
+	// listed for status only.
+	Stoppable bool `json:"stoppable"`
+}
+
+// QueuedRun is a run waiting for a worker, as served on QueuePath.
+type QueuedRun struct {
+	Job       string `json:"job"`
+	Signature string `json:"signature"`
+	Priority  int    `json:"priority,omitempty"`
+	// Position is 1 for the run admitted next.
+	Position   int       `json:"position"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+}
+
+// QueueInfo describes a queue class and the runs waiting in it, as served on
+// QueuePath. Processed and Rejected count runs since the server started.
+type QueueInfo struct {
+	Class     string      `json:"class"`
+	Workers   int         `json:"workers"`
+	Running   int         `json:"running"`
+	Depth     int         `json:"depth"`
+	Capacity  int         `json:"capacity"`
+	Processed uint64      `json:"processed"`
+	Rejected  uint64      `json:"rejected"`
+	Waiting   []QueuedRun `json:"waiting"`
+}
+
+// Response is the reply envelope sent to clients that accept JSONContentType;
+// other clients receive only the Status text.
+type Response struct {
+	Status    string `json:"status"`
+	Job       string `json:"job,omitempty"`
+	Signature string `json:"signature,omitempty"`
+	Message   string `json:"message,omitempty"`
+	// Result is the value a handler returned, encoded according to ResultType.
+	Result     json.RawMessage `json:"result,omitempty"`
+	ResultType string          `json:"result_type,omitempty"`
+	// Outputs are the key/value pairs a handler returned.
+	Outputs map[string]string `json:"outputs,omitempty"`
+	// RetryAfter is how many seconds a rate limited caller should wait.
+	RetryAfter float64 `json:"retry_after,omitempty"`
+	// Replayed marks the reply of an earlier run with the same idempotency
+	// key, returned instead of running the job again.
+	Replayed bool `json:"replayed,omitempty"`
+	// State is where stopped runs ended up, in replies to stop requests: one
+	// of RunStopping, RunStopped, RunUnresponsive or RunAbandoned.
+	State string `json:"state,omitempty"`
+	// StopReason is the reason given by the stop that ended the run, if any.
+	StopReason string `json:"stop_reason,omitempty"`
+	// Stopped counts the runs a filtered stop on StopPath asked to stop.
+	Stopped int `json:"stopped,omitempty"`
+}
+
+// RunRecord is a finished run kept in a registry's history.
+type RunRecord struct {
+	Response
+	Args       map[string]string `json:"args,omitempty"`
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt time.Time         `json:"finished_at"`
+}
+
+// BatchItem is one invocation inside a BatchRequest.
+type BatchItem struct {
+	Signature string            `json:"signature,omitempty"`
+	Params    map[string]string `json:"params,omitempty"`
+}
+
+// BatchRequest asks the server to run Job once per item, with at most
+// Concurrency items in flight at a time.
+type BatchRequest struct {
+	Job         string      `json:"job"`
+	Concurrency int         `json:"concurrency,omitempty"`
+	Items       []BatchItem `json:"items"`
+}
+
+// BatchResponse holds one Response per BatchRequest item, in request order.
+type BatchResponse struct {
+	Job     string     `json:"job"`
+	Results []Response `json:"results"`
+}
+
+// Event describes something that happened to a run, as published on a
+// registry's event bus and streamed from EventsPath.
+type Event struct {
+	Type      string    `json:"type"`
+	Job       string    `json:"job"`
+	Signature string    `json:"signature,omitempty"`
+	Time      time.Time `json:"time"`
+	Message   string    `json:"message,omitempty"`
+	// Percent is set on progress events when the handler reports one.
+	Percent float64 `json:"percent,omitempty"`
+}
+
+// StepResult is the outcome of one workflow step. Steps that never started
+// have Status SKIPPED and no Signature.
+type StepResult struct {
+	Step      string `json:"step"`
+	Job       string `json:"job"`
+	Signature string `json:"signature,omitempty"`
+	Status    string `json:"status"`
+	Message   string `json:"message,omitempty"`
+}
@@ -0,0 +1,300 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Kingson4Wu/saturncli/base"
+	"github.com/google/uuid"
+)
+
+// Batch describes many runs of one job submitted in a single request.
+type Batch struct {
+	Name string
+	// Args and Params apply to every item; values given by an item win.
+	Args   string
+	Params map[string]string
+	Items  []map[string]string
+	// Concurrency caps how many items the server runs at once. The server
+	// clamps it to its own limit; zero runs the items one after another.
+	Concurrency int
+}
+
+// BatchItemResult is the outcome of one item of a Batch.
+type BatchItemResult struct {
+	// Params are the parameters the item was run with, after merging.
+	Params map[string]string
+	Result
+	// Err is nil when the item succeeded, otherwise an error as returned by RunContext.
+	Err error
+}
+
+// BatchResult lists the item outcomes in the order the items were given.
+type BatchResult struct {
+	Items  []BatchItemResult
+	Failed int
+}
+
+// RunBatch submits every item of batch in one request and waits for all of
+// them. The request is bounded only by ctx, not by the per-run timeout. When
+// at least one item fails the result is returned together with an error
+// matching ErrJobFailed.
+func (c *cli) RunBatch(ctx context.Context, batch *Batch) (*BatchResult, error) {
+	if batch == nil || strings.TrimSpace(batch.Name) == "" {
+		return nil, fmt.Errorf("%w: batch job name is empty", ErrInvalidTask)
+	}
+	request := base.BatchRequest{
+		Job:         batch.Name,
+		Concurrency: batch.Concurrency,
+		Items:       make([]base.BatchItem, 0, len(batch.Items)),
+	}
+	for i, item := range batch.Items {
+		params := cloneStringMap(batch.Params)
+		if params == nil {
+			params = make(map[string]string, len(item))
+		}
+		for k, v := range item {
+			params[k] = v
+		}
+		args, err := (&Task{Name: batch.Name, Args: batch.Args, Params: params}).flatArgs()
+		if err != nil {
+			return nil, fmt.Errorf("%w: batch item %d: %v", ErrInvalidTask, i+1, err)
+		}
+		signature := ""
+		if v, err := uuid.NewUUID(); err == nil {
+			signature = v.String()
+		}
+		request.Items = append(request.Items, base.BatchItem{Signature: signature, Params: args})
+	}
+	c.logger.Infof("saturn client batch run, task: %v, items: %d, concurrency: %d", batch.Name, len(request.Items), batch.Concurrency)
+
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, adminURL(base.BatchPath), bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", base.JSONContentType)
+	req.Header.Set("Accept", base.JSONContentType)
+
+	response, bodyData, err := c.doWith(c.untimedHTTPClient(), req)
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+		return nil, &classifiedError{kind: ErrInterrupted, err: ctxErr}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, replyError(batch.Name, response.StatusCode, decodeReply(response, bodyData))
+	}
+	var reply base.BatchResponse
+	if err := json.Unmarshal(bodyData, &reply); err != nil {
+		return nil, fmt.Errorf("decode batch reply: %w", err)
+	}
+	if len(reply.Results) != len(request.Items) {
+		return nil, fmt.Errorf("batch reply has %d results for %d items", len(reply.Results), len(request.Items))
+	}
+
+	result := &BatchResult{Items: make([]BatchItemResult, len(reply.Results))}
+	for i, resp := range reply.Results {
+		item := BatchItemResult{
+			Params: request.Items[i].Params,
+			Result: resultFromReply(resp),
+			Err:    replyError(batch.Name, http.StatusOK, resp),
+		}
+		if item.Err != nil {
+			result.Failed++
+		}
+		result.Items[i] = item
+	}
+	if result.Failed > 0 {
+		return result, fmt.Errorf("%w: %d of %d batch items failed", ErrJobFailed, result.Failed, len(result.Items))
+	}
+	return result, nil
+}
+
+// flatArgs resolves the query the task would send into one value per key,
+// which is what the server hands to job handlers.
+func (task *Task) flatArgs() (map[string]string, error) {
+	query, err := task.queryString()
+	if err != nil {
+		return nil, err
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	args := make(map[string]string, len(values))
+	for k, v := range values {
+		if len(v) > 0 {
+			args[k] = v[0]
+		}
+	}
+	return args, nil
+}
+
+// parseBatchItems reads parameter sets either as JSON lines, one object per
+// line, or as CSV whose header row names the parameters. The format is
+// detected from the first non-blank character.
+func parseBatchItems(r io.Reader) ([]map[string]string, error) {
+	reader := bufio.NewReader(r)
+	for {
+		b, err := reader.Peek(1)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, errors.New("batch input is empty")
+			}
+			return nil, err
+		}
+		if b[0] == ' ' || b[0] == '\t' || b[0] == '\r' || b[0] == '\n' {
+			_, _ = reader.ReadByte()
+			continue
+		}
+		if b[0] == '{' {
+			return parseJSONLines(reader)
+		}
+		return parseCSV(reader)
+	}
+}
+
+func parseJSONLines(r io.Reader) ([]map[string]string, error) {
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	var items []map[string]string
+	for {
+		var raw map[string]interface{}
+		if err := decoder.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				return items, nil
+			}
+			return nil, fmt.Errorf("batch item %d: %w", len(items)+1, err)
+		}
+		item := make(map[string]string, len(raw))
+		for k, v := range raw {
+			switch value := v.(type) {
+			case string:
+				item[k] = value
+			case json.Number:
+				item[k] = value.String()
+			default:
+				encoded, err := json.Marshal(value)
+				if err != nil {
+					return nil, fmt.Errorf("batch item %d: %w", len(items)+1, err)
+				}
+				item[k] = string(encoded)
+			}
+		}
+		items = append(items, item)
+	}
+}
+
+func parseCSV(r io.Reader) ([]map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("batch csv header: %w", err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+		if header[i] == "" {
+			return nil, fmt.Errorf("batch csv header column %d is empty", i+1)
+		}
+	}
+	var items []map[string]string
+	for {
+		record, err := reader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return items, nil
+			}
+			return nil, fmt.Errorf("batch csv: %w", err)
+		}
+		item := make(map[string]string, len(header))
+		for i, value := range record {
+			item[header[i]] = value
+		}
+		items = append(items, item)
+	}
+}
+
+// formatParams renders params as sorted key=value pairs for summaries.
+func formatParams(params map[string]string) string {
+	parts := make([]string, 0, len(params))
+	for k, v := range params {
+		parts = append(parts, k+"="+v)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func (c *cmd) executeBatch(opts *cmdOptions) int {
+	var input io.Reader = os.Stdin
+	if opts.batch != "-" {
+		file, err := os.Open(opts.batch)
+		if err != nil {
+			c.logger.Errorf("saturn client open batch file failure: %+v", err)
+			fmt.Fprintln(os.Stderr, "Execution Failure")
+			return 1
+		}
+		defer file.Close()
+		input = file
+	}
+	items, err := parseBatchItems(input)
+	if err != nil {
+		c.logger.Errorf("saturn client read batch failure: %+v", err)
+		fmt.Fprintln(os.Stderr, "Execution Failure")
+		return 1
+	}
+
+	ctx, stopSignals := signalContext(context.Background(), c.logger)
+	defer stopSignals()
+	result, err := c.newClient().RunBatch(ctx, &Batch{
+		Name:        opts.name,
+		Args:        opts.args,
+		Params:      cloneStringMap(opts.params),
+		Items:       items,
+		Concurrency: opts.concurrency,
+	})
+	if result == nil {
+		c.logger.Errorf("saturn client batch failure: %+v", err)
+		if errors.Is(err, ErrInterrupted) {
+			fmt.Fprintln(os.Stderr, "Execution Interrupted")
+		} else {
+			fmt.Fprintln(os.Stderr, "Execution Failure")
+		}
+		return 1
+	}
+
+	writeBatchSummary(os.Stdout, result)
+	if result.Failed > 0 {
+		fmt.Fprintf(os.Stderr, "Execution Failure: %d of %d items failed\n", result.Failed, len(result.Items))
+		return 1
+	}
+	fmt.Fprintln(os.Stderr, "Execution Success")
+	return 0
+}
+
+func writeBatchSummary(w io.Writer, result *BatchResult) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tSTATUS\tSIGNATURE\tPARAMS\tMESSAGE")
+	for i, item := range result.Items {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\n", i+1, item.Status, item.Signature, formatParams(item.Params), item.Message)
+	}
+	_ = tw.Flush()
+	fmt.Fprintf(w, "%d succeeded, %d failed\n", len(result.Items)-result.Failed, result.Failed)
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/server"
+	"github.com/Kingson4Wu/saturncli/utils"
+)
+
+func TestParseBatchItems(t *testing.T) {
+	want := []map[string]string{
+		{"tenant": "1", "mode": "full"},
+		{"tenant": "2", "mode": "delta"},
+	}
+
+	csvItems, err := parseBatchItems(strings.NewReader("tenant, mode\n1,full\n2,delta\n"))
+	if err != nil {
+		t.Fatalf("csv: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(csvItems, want) {
+		t.Fatalf("csv: got %v, want %v", csvItems, want)
+	}
+
+	jsonItems, err := parseBatchItems(strings.NewReader("\n{\"tenant\": 1, \"mode\": \"full\"}\n{\"tenant\": \"2\", \"mode\": \"delta\"}\n"))
+	if err != nil {
+		t.Fatalf("json lines: unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(jsonItems, want) {
+		t.Fatalf("json lines: got %v, want %v", jsonItems, want)
+	}
+
+	if _, err := parseBatchItems(strings.NewReader("  \n")); err == nil {
+		t.Fatal("expected error for empty input")
+	}
+	if _, err := parseBatchItems(strings.NewReader("{\"tenant\": 1}\n{broken")); err == nil {
+		t.Fatal("expected error for malformed json line")
+	}
+}
+
+func TestRunBatch(t *testing.T) {
+	registry := server.NewRegistry()
+	var mu sync.Mutex
+	seen := map[string]string{}
+	if err := registry.AddJob("tenant", func(m map[string]string, signature string) bool {
+		mu.Lock()
+		seen[m["tenant"]] = m["mode"]
+		mu.Unlock()
+		return m["tenant"] != "3"
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+
+	socket := filepath.Join(os.TempDir(), fmt.Sprintf("saturncli-batch-%d.sock", time.Now().UnixNano()))
+	go server.NewServer(&utils.DefaultLogger{}, socket, server.WithRegistry(registry)).Serve()
+	time.Sleep(300 * time.Millisecond)
+
+	items := []map[string]string{{"tenant": "1"}, {"tenant": "2", "mode": "delta"}, {"tenant": "3"}, {"tenant": "4"}}
+	result, err := NewClient(&utils.DefaultLogger{}, socket).RunBatch(context.Background(), &Batch{
+		Name:        "tenant",
+		Params:      map[string]string{"mode": "full"},
+		Items:       items,
+		Concurrency: 2,
+	})
+	if !errors.Is(err, ErrJobFailed) {
+		t.Fatalf("expected ErrJobFailed for the failing item, got %v", err)
+	}
+	if result == nil || len(result.Items) != len(items) || result.Failed != 1 {
+		t.Fatalf("unexpected batch result: %+v", result)
+	}
+	for i, item := range result.Items {
+		if item.Params["tenant"] != items[i]["tenant"] || item.Signature == "" {
+			t.Fatalf("item %d out of order or unsigned: %+v", i, item)
+		}
+		if (item.Err != nil) != (items[i]["tenant"] == "3") {
+			t.Fatalf("item %d: unexpected error %v", i, item.Err)
+		}
+	}
+	if seen["1"] != "full" || seen["2"] != "delta" {
+		t.Fatalf("batch defaults were not merged: %v", seen)
+	}
+
+	file := filepath.Join(t.TempDir(), "items.csv")
+	if err := os.WriteFile(file, []byte("tenant\n1\n3\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cmd := NewCmd(&utils.DefaultLogger{}, socket)
+	if code := cmd.Execute([]string{"run", "-name", "tenant", "-batch", file}); code != 1 {
+		t.Fatalf("expected exit code 1 when an item fails, got %d", code)
+	}
+	if err := os.WriteFile(file, []byte("tenant\n1\n2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if code := cmd.Execute([]string{"run", "-name", "tenant", "-batch", file, "-concurrency", "2"}); code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+}
@@ -9,17 +9,17 @@ import (
 )
 
 func (c *cli) buildHTTPClient() *http.Client {
+	dialer := &net.Dialer{Timeout: c.dialTimeout}
 	return &http.Client{
-		Timeout: defaultRequestTimeout,
-		Transport: &http.Transport{
-			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
-				d := net.Dialer{}
-				return d.DialContext(ctx, "unix", c.sockPath)
-			},
-		},
+		Timeout: c.requestTimeout,
+		Transport: c.newTransport(func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", c.sockPath)
+		}),
 	}
 }
 
+const transportHost = "unix"
+
 func (task *Task) buildURL() (string, error) {
-	return task.buildURLForHost("unix")
+	return task.buildURLForHost(transportHost)
 }
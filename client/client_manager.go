@@ -1,17 +1,20 @@
 package client
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/Kingson4Wu/saturncli/base"
 	"github.com/Kingson4Wu/saturncli/utils"
 	"github.com/google/uuid"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
-	"sync"
 	"time"
 )
 
@@ -22,122 +25,394 @@ type Task struct {
 	Params    map[string]string
 	Stop      bool
 	Signature string
+	// IdempotencyKey makes retrying the task safe: the server replays the
+	// reply of an earlier run with the same key, or waits for it to finish,
+	// instead of running the job again. It defaults to Signature. When both
+	// are empty every run gets a fresh signature, reported by Result.Signature
+	// and RunError.Signature; set it as Signature to retry that run.
+	IdempotencyKey string
+	// Values carries multi-valued parameters; every value reaches request-style
+	// jobs in order through JobRequest.Values.
+	Values url.Values
+	// MultiValue keeps every value of a key repeated in Args instead of only
+	// the first one.
+	MultiValue bool
+	// Data is sent as the request body for input that does not fit in query
+	// parameters; request-style jobs receive it as JobRequest.Payload.
+	Data []byte
+	// ContentType describes Data and defaults to application/json.
+	ContentType string
+	// Resume is the signature of an interrupted run to continue. The run
+	// reuses that signature and its handler receives the last checkpoint.
+	Resume string
+	// Priority orders the run in a server-side queue; higher runs first.
+	Priority int
+	// StopWait makes a stop wait up to this long for the runs to exit; the
+	// result's State then says whether they did. Zero only asks them to stop.
+	StopWait time.Duration
+	// StopForce abandons runs that have not exited when the stop is done
+	// waiting, so their queue slot and run record are released. A job lock
+	// stays held until the abandoned handler returns.
+	StopForce bool
+	// StopReason says why the runs are stopped; their handlers and history
+	// records get it.
+	StopReason string
 }
 
+// cli is safe for concurrent use by multiple goroutines. It keeps one HTTP
+// transport for its lifetime so connections to the server are reused; create
+// one client per socket and share it rather than building one per call.
 type cli struct {
-	logger   utils.Logger
-	sockPath string
+	logger        utils.Logger
+	sockPath      string
+	handleSignals bool
+
+	requestTimeout      time.Duration
+	dialTimeout         time.Duration
+	maxIdleConns        int
+	maxIdleConnsPerHost int
+	maxConnsPerHost     int
+	idleConnTimeout     time.Duration
+	httpc               *http.Client
+	onQueued            func(base.QueuedRun)
+	callerToken         string
+	rateLimitWait       time.Duration
+	// dial, when set, replaces the platform's way of reaching the server.
+	dial func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// ClientOption customises a client created by NewClient.
+type ClientOption func(*cli)
+
+// WithSignalHandling makes every run listen for SIGINT/SIGTERM-style signals
+// and treat them like a cancelled context, stopping the remote run. It
+// installs process-wide handlers for the duration of each call, so it is
+// meant for command-line front ends rather than long-running hosts.
+func WithSignalHandling() ClientOption {
+	return func(c *cli) {
+		c.handleSignals = true
+	}
+}
+
+// WithRequestTimeout bounds how long a single run may wait for the server to
+// reply. Zero disables the bound and leaves it to the caller's context.
+func WithRequestTimeout(timeout time.Duration) ClientOption {
+	return func(c *cli) {
+		c.requestTimeout = timeout
+	}
+}
+
+// WithDialTimeout bounds how long establishing a new connection may take.
+func WithDialTimeout(timeout time.Duration) ClientOption {
+	return func(c *cli) {
+		c.dialTimeout = timeout
+	}
+}
+
+// WithMaxIdleConns sets how many idle connections are kept for reuse.
+func WithMaxIdleConns(n int) ClientOption {
+	return func(c *cli) {
+		c.maxIdleConns = n
+		c.maxIdleConnsPerHost = n
+	}
+}
+
+// WithMaxConnsPerHost caps the number of connections, idle or active, to the
+// server. Zero means no limit.
+func WithMaxConnsPerHost(n int) ClientOption {
+	return func(c *cli) {
+		c.maxConnsPerHost = n
+	}
+}
+
+// WithIdleConnTimeout sets how long an idle connection is kept before closing.
+func WithIdleConnTimeout(timeout time.Duration) ClientOption {
+	return func(c *cli) {
+		c.idleConnTimeout = timeout
+	}
+}
+
+// WithDialer makes the client open its connections with dial instead of the
+// socket path, such as the DialContext of a server's ServeLocal to call jobs
+// in the same process. The socket path is then ignored.
+func WithDialer(dial func(ctx context.Context, network, addr string) (net.Conn, error)) ClientOption {
+	return func(c *cli) {
+		c.dial = dial
+	}
+}
+
+// Result reports the outcome of a run returned by RunContext.
+type Result struct {
+	// Status is the reply of the server, usually one of base.SUCCESS,
+	// base.FAILURE or base.INTERRUPT.
+	Status string
+	// Signature identifies the run on the server; it is empty for stop requests.
+	Signature string
+	// Message carries the explanation the server attached to the status, if any.
+	Message string
+	// Value is the result the handler returned: raw JSON when ValueType is
+	// base.ResultJSON, otherwise the text or bytes themselves.
+	Value     []byte
+	ValueType string
+	// Outputs are the key/value pairs the handler returned.
+	Outputs map[string]string
+	// Replayed reports a reply recorded for an earlier run with the same
+	// idempotency key; the job did not run again.
+	Replayed bool
+	// State is where the runs of a stop request ended up, one of
+	// base.RunStopping, base.RunStopped or base.RunAbandoned.
+	State string
+	// StopReason is the reason given by the stop that ended the run, if any.
+	StopReason string
+}
+
+// Decode unmarshals a JSON result value into v.
+func (r *Result) Decode(v any) error {
+	if len(r.Value) == 0 {
+		return errors.New("result has no value")
+	}
+	if r.ValueType != base.ResultJSON {
+		return fmt.Errorf("result value is %s, not json", r.ValueType)
+	}
+	return json.Unmarshal(r.Value, v)
+}
+
+// resultFromReply converts a reply envelope into a Result, unwrapping the
+// encoded result value.
+func resultFromReply(reply base.Response) Result {
+	result := Result{
+		Status:     reply.Status,
+		Signature:  reply.Signature,
+		Message:    reply.Message,
+		ValueType:  reply.ResultType,
+		Outputs:    reply.Outputs,
+		Replayed:   reply.Replayed,
+		State:      reply.State,
+		StopReason: reply.StopReason,
+	}
+	if len(reply.Result) == 0 {
+		return result
+	}
+	switch reply.ResultType {
+	case base.ResultText:
+		var text string
+		if err := json.Unmarshal(reply.Result, &text); err == nil {
+			result.Value = []byte(text)
+		}
+	case base.ResultBytes:
+		var raw []byte
+		if err := json.Unmarshal(reply.Result, &raw); err == nil {
+			result.Value = raw
+		}
+	default:
+		result.Value = reply.Result
+	}
+	return result
 }
 
 const (
-	defaultRequestTimeout = 60 * time.Second
-	stopRequestTimeout    = 10 * time.Second
+	defaultRequestTimeout  = 60 * time.Second
+	stopRequestTimeout     = 10 * time.Second
+	defaultDialTimeout     = 5 * time.Second
+	defaultMaxIdleConns    = 16
+	defaultIdleConnTimeout = 90 * time.Second
 )
 
 // NewClient constructs a client capable of communicating with the Saturn server over the provided socket path.
-func NewClient(logger utils.Logger, sockPath string) *cli {
-	return &cli{
-		logger:   logger,
-		sockPath: sockPath,
+func NewClient(logger utils.Logger, sockPath string, opts ...ClientOption) *cli {
+	c := &cli{
+		logger:              logger,
+		sockPath:            sockPath,
+		requestTimeout:      defaultRequestTimeout,
+		dialTimeout:         defaultDialTimeout,
+		maxIdleConns:        defaultMaxIdleConns,
+		maxIdleConnsPerHost: defaultMaxIdleConns,
+		idleConnTimeout:     defaultIdleConnTimeout,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.dial != nil {
+		c.httpc = &http.Client{Timeout: c.requestTimeout, Transport: c.newTransport(c.dial)}
+	} else {
+		c.httpc = c.buildHTTPClient()
 	}
+	return c
+}
+
+// newTransport returns the pooled transport shared by every request of c;
+// dial is the platform specific way of reaching the server.
+func (c *cli) newTransport(dial func(ctx context.Context, network, addr string) (net.Conn, error)) *http.Transport {
+	return &http.Transport{
+		DialContext:         dial,
+		MaxIdleConns:        c.maxIdleConns,
+		MaxIdleConnsPerHost: c.maxIdleConnsPerHost,
+		MaxConnsPerHost:     c.maxConnsPerHost,
+		IdleConnTimeout:     c.idleConnTimeout,
+	}
+}
+
+// untimedHTTPClient shares the pooled transport but leaves the deadline to the
+// request context, for calls expected to outlive the per-run timeout.
+func (c *cli) untimedHTTPClient() *http.Client {
+	return &http.Client{Transport: c.httpc.Transport}
+}
+
+// CloseIdleConnections closes connections kept for reuse; the client remains usable.
+func (c *cli) CloseIdleConnections() {
+	c.httpc.CloseIdleConnections()
 }
 
+// Run executes task and returns the server reply as a plain status string.
+// It is kept for existing callers; new code should prefer RunContext.
 func (c *cli) Run(task *Task) string {
+	result, err := c.RunContext(context.Background(), task)
+	if result != nil {
+		return result.Status
+	}
+	if err != nil {
+		return base.FAILURE
+	}
+	return base.SUCCESS
+}
 
+// RunContext executes task and blocks until the server replies or ctx is done.
+// Cancelling ctx abandons the request and asks the server to stop the run; the
+// returned error then matches ErrInterrupted. RunContext never exits the
+// process and only installs signal handlers when WithSignalHandling is set.
+// A run refused by a rate limit returns a *RateLimitError, after waiting and
+// retrying as long as WithRateLimitWait allows.
+func (c *cli) RunContext(ctx context.Context, task *Task) (*Result, error) {
+	var waited time.Duration
+	for {
+		result, err := c.runOnce(ctx, task)
+		var limited *RateLimitError
+		if !errors.As(err, &limited) || task.Stop || limited.RetryAfter <= 0 || waited+limited.RetryAfter > c.rateLimitWait {
+			return result, err
+		}
+		c.logger.Warnf("saturn client rate limited, task: %s, retrying in %s", task.Name, limited.RetryAfter)
+		timer := time.NewTimer(limited.RetryAfter)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result, err
+		case <-timer.C:
+		}
+		waited += limited.RetryAfter
+	}
+}
+
+func (c *cli) runOnce(ctx context.Context, task *Task) (*Result, error) {
 	if task == nil {
 		c.logger.Errorf("saturn client run received nil task")
-		return base.FAILURE
+		return nil, fmt.Errorf("%w: task is nil", ErrInvalidTask)
 	}
 
 	if task.Name == "" {
 		c.logger.Warnf("saturn client run, task name is empty, args:%v", task.Args)
-		return base.FAILURE
+		return nil, fmt.Errorf("%w: task name is empty", ErrInvalidTask)
 	}
 	c.logger.Infof("saturn client run, task: %v, args: %v, params: %v", task.Name, task.Args, task.Params)
 
 	requestURL, err := task.buildURL()
 	if err != nil {
 		c.logger.Errorf("saturn client build url failure, task: %s, args:%s, err: %+v", task.Name, task.Args, err)
-		return base.FAILURE
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTask, err)
 	}
 
-	httpc := c.buildHTTPClient()
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
+	if c.handleSignals {
+		var stopSignals context.CancelFunc
+		ctx, stopSignals = signalContext(ctx, c.logger)
+		defer stopSignals()
+	}
+
+	method, body := http.MethodGet, io.Reader(nil)
+	if len(task.Data) > 0 && !task.Stop {
+		method, body = http.MethodPost, bytes.NewReader(task.Data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, requestURL, body)
 	if err != nil {
 		c.logger.Errorf("saturn client create request failure, task: %s, args:%s, err: %+v", task.Name, task.Args, err)
-		return base.FAILURE
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTask, err)
 	}
-	runSignature := ""
-	if v, err := uuid.NewUUID(); err == nil {
-		runSignature = v.String()
+	req.Header.Set("Accept", base.JSONContentType)
+	if body != nil {
+		contentType := task.ContentType
+		if contentType == "" {
+			contentType = base.JSONContentType
+		}
+		req.Header.Set("Content-Type", contentType)
 	}
-
-	if task.Stop {
+	runSignature := ""
+	switch {
+	case task.Stop:
 		addStopOption(req, task.Signature)
-	} else {
-		if runSignature != "" {
+		if task.StopWait > 0 {
+			req.Header.Set(base.StopWait, task.StopWait.String())
+		}
+		if task.StopForce {
+			req.Header.Set(base.StopForce, "true")
+		}
+		if task.StopReason != "" {
+			req.Header.Set(base.StopReason, task.StopReason)
+		}
+	case task.Resume != "":
+		runSignature = task.Resume
+		req.Header.Set(base.RunSignature, runSignature)
+		req.Header.Set(base.ResumeRun, runSignature)
+	case task.Signature != "":
+		runSignature = task.Signature
+		req.Header.Set(base.RunSignature, runSignature)
+	default:
+		if v, err := uuid.NewUUID(); err == nil {
+			runSignature = v.String()
 			req.Header.Set(base.RunSignature, runSignature)
 		}
 	}
-
-	var wg sync.WaitGroup
-	var interrupt bool
-	requestFinishChan := make(chan struct{})
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		signalChan := utils.ListenSignal()
-		defer utils.StopSignal(signalChan)
-		select {
-		case <-requestFinishChan:
-			c.logger.Infof("saturn client listen signal, response finish : %s, signature: %s, args:%s", task.Name, runSignature, task.Args)
-		case signal := <-signalChan:
-			if signal == nil {
-				return
-			}
-			c.logger.Warnf("saturn client listen signal: %s, request interrupt : %s, signature: %s, args:%s", signal, task.Name, runSignature, task.Args)
-			if !task.Stop && runSignature != "" {
-				c.stop(task, runSignature)
-			}
-			interrupt = true
-			cancel()
-		}
-	}()
-	var (
-		response *http.Response
-	)
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		defer close(requestFinishChan)
-		response, err = httpc.Do(req)
-	}()
-	wg.Wait()
-
-	if interrupt {
-		return base.INTERRUPT
+	if task.IdempotencyKey != "" && !task.Stop {
+		req.Header.Set(base.IdempotencyKey, task.IdempotencyKey)
 	}
 
-	//response, err := httpc.Do(req)
-	if err != nil {
-		c.logger.Errorf("saturn client fail to request server, task: %s, signature: %s, args:%s, err: %+v", task.Name, runSignature, task.Args, err)
-		return base.FAILURE
+	if task.Priority != 0 && !task.Stop {
+		req.Header.Set(base.RunPriority, strconv.Itoa(task.Priority))
+	}
+	if c.onQueued != nil && runSignature != "" {
+		stopWatching := c.watchQueue(ctx, task.Name, runSignature)
+		defer stopWatching()
 	}
 
-	defer func() {
-		if err := response.Body.Close(); err != nil {
-			c.logger.Warnf("saturn client failed to close response body: %v", err)
+	httpc := c.httpc
+	if task.Stop && task.StopWait > 0 && c.requestTimeout > 0 {
+		// the server holds its reply until the runs exit or the wait is over
+		httpc = &http.Client{Transport: c.httpc.Transport, Timeout: c.requestTimeout + task.StopWait}
+	}
+	response, bodyData, err := c.doWith(httpc, req)
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+		c.logger.Warnf("saturn client request interrupt : %s, signature: %s, args:%s, cause: %v", task.Name, runSignature, task.Args, ctxErr)
+		if !task.Stop && runSignature != "" {
+			c.stop(task, runSignature)
 		}
-	}()
-	bodyData, err := io.ReadAll(response.Body)
+		kind := ErrInterrupted
+		if errors.Is(ctxErr, context.DeadlineExceeded) {
+			kind = ErrTimeout
+		}
+		return &Result{Status: base.INTERRUPT, Signature: runSignature}, &classifiedError{kind: kind, err: ctxErr}
+	}
 	if err != nil {
-		c.logger.Errorf("saturn client read resp body failure from server, task: %s, signature: %s, args:%se, err: %+v", task.Name, runSignature, task.Args, err)
-		return base.FAILURE
+		c.logger.Errorf("saturn client fail to request server, task: %s, signature: %s, args:%s, err: %+v", task.Name, runSignature, task.Args, err)
+		if runSignature == "" {
+			return nil, err
+		}
+		return &Result{Status: base.FAILURE, Signature: runSignature}, &RunError{Job: task.Name, Signature: runSignature, Err: err}
 	}
 	c.logger.Infof("saturn client receive result from server, task: %s, signature: %s, args:%s, resp: %s", task.Name, runSignature, task.Args, string(bodyData))
-	return string(bodyData)
+
+	reply := decodeReply(response, bodyData)
+	if reply.Signature == "" {
+		reply.Signature = runSignature
+	}
+	result := resultFromReply(reply)
+	return &result, replyError(task.Name, response.StatusCode, reply)
 }
 
 func addStopOption(req *http.Request, signature string) {
@@ -157,29 +432,105 @@ func (c *cli) stop(task *Task, signature string) {
 	ctx, cancel := context.WithTimeout(context.Background(), stopRequestTimeout)
 	defer cancel()
 
-	httpc := c.buildHTTPClient()
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestURL, nil)
 	if err != nil {
 		c.logger.Errorf("saturn client [stop] create request failure, task: %s, signature: %s, request server failure, err: %+v", task.Name, signature, err)
 		return
 	}
 	addStopOption(req, signature)
-	response, err := httpc.Do(req)
+	response, bodyData, err := c.do(req)
 	if err != nil {
 		c.logger.Errorf("saturn client [stop] receive result from server, task: %s, signature: %s, request server failure, err: %+v", task.Name, signature, err)
 		return
 	}
+	if decodeReply(response, bodyData).Status == base.NOT_STOPPABLE {
+		c.logger.Warnf("saturn client [stop] job is not stoppable, the run goes on on the server, task: %s, signature: %s", task.Name, signature)
+		return
+	}
+	c.logger.Warnf("saturn client [stop] receive result from server, task: %s, signature: %s, resp: %s", task.Name, signature, string(bodyData))
+}
+
+// ListJobs asks the server which jobs are registered, including declared
+// parameters and the signatures of runs currently in flight. Hidden jobs are
+// left out unless WithHidden is given.
+func (c *cli) ListJobs(ctx context.Context, opts ...ListOption) ([]base.JobInfo, error) {
+	query := url.Values{}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(query)
+		}
+	}
+	target := adminURL(base.JobsPath)
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, bodyData, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, replyError("", response.StatusCode, decodeReply(response, bodyData))
+	}
+	var jobs []base.JobInfo
+	if err := json.Unmarshal(bodyData, &jobs); err != nil {
+		return nil, fmt.Errorf("decode job list: %w", err)
+	}
+	return jobs, nil
+}
+
+// do sends req and reads the whole body. Transport failures are classified as
+// ErrTimeout or ErrServerUnavailable.
+func (c *cli) do(req *http.Request) (*http.Response, []byte, error) {
+	return c.doWith(c.httpc, req)
+}
+
+func (c *cli) doWith(httpc *http.Client, req *http.Request) (*http.Response, []byte, error) {
+	if c.callerToken != "" {
+		req.Header.Set(base.CallerToken, c.callerToken)
+	}
+	response, err := httpc.Do(req)
+	if err != nil {
+		return nil, nil, classifyTransportError(err)
+	}
 	defer func() {
 		if err := response.Body.Close(); err != nil {
-			c.logger.Warnf("saturn client [stop] failed to close response body: %v", err)
+			c.logger.Warnf("saturn client failed to close response body: %v", err)
 		}
 	}()
 	bodyData, err := io.ReadAll(response.Body)
 	if err != nil {
-		c.logger.Errorf("saturn client [stop] read resp body failure from server, task: %s, signature: %s, request server failure, err: %+v", task.Name, signature, err)
-		return
+		return nil, nil, classifyTransportError(err)
 	}
-	c.logger.Warnf("saturn client [stop] receive result from server, task: %s, signature: %s, resp: %s", task.Name, signature, string(bodyData))
+	return response, bodyData, nil
+}
+
+// decodeReply accepts both the JSON envelope and the bare status text
+// written for clients that do not ask for JSON.
+func decodeReply(response *http.Response, bodyData []byte) base.Response {
+	var reply base.Response
+	if strings.HasPrefix(response.Header.Get("Content-Type"), base.JSONContentType) {
+		if err := json.Unmarshal(bodyData, &reply); err == nil && reply.Status != "" {
+			return reply
+		}
+	}
+	reply.Status = strings.TrimSpace(string(bodyData))
+	if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil {
+		reply.RetryAfter = float64(seconds)
+	}
+	return reply
+}
+
+func adminURL(path string) string {
+	u := url.URL{
+		Scheme: "http",
+		Host:   transportHost,
+		Path:   path,
+	}
+	return u.String()
 }
 
 func (task *Task) buildURLForHost(host string) (string, error) {
@@ -205,11 +556,19 @@ func (task *Task) buildURLForHost(host string) (string, error) {
 	return u.String(), nil
 }
 
+// queryString merges Params, Values and Args into the request query. Keys
+// given in Params or Values take precedence over the same key in Args; for a
+// key present in both Params and Values the Params value comes first.
 func (task *Task) queryString() (string, error) {
 	values := url.Values{}
 	for k, v := range task.Params {
 		values.Set(k, v)
 	}
+	for k, vs := range task.Values {
+		for _, v := range vs {
+			values.Add(k, v)
+		}
+	}
 
 	raw := strings.TrimPrefix(task.Args, "?")
 	if raw != "" {
@@ -224,6 +583,10 @@ func (task *Task) queryString() (string, error) {
 			if _, exists := values[k]; exists {
 				continue
 			}
+			if task.MultiValue {
+				values[k] = v
+				continue
+			}
 			values.Set(k, v[0])
 		}
 	}
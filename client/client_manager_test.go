@@ -0,0 +1,496 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+	"github.com/Kingson4Wu/saturncli/client"
+	"github.com/Kingson4Wu/saturncli/server"
+	"github.com/Kingson4Wu/saturncli/utils"
+)
+
+func TestRunContext(t *testing.T) {
+	registry := server.NewRegistry()
+	if err := registry.AddJob("hello", func(m map[string]string, signature string) bool {
+		return m["ok"] == "true"
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+
+	socket := tempSocketPath(t, "run-context")
+	go server.NewServer(&utils.DefaultLogger{}, socket, server.WithRegistry(registry)).Serve()
+	time.Sleep(300 * time.Millisecond)
+
+	cli := client.NewClient(&utils.DefaultLogger{}, socket)
+
+	result, err := cli.RunContext(context.Background(), &client.Task{Name: "hello", Params: map[string]string{"ok": "true"}})
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	if result.Status != base.SUCCESS || result.Signature == "" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	result, err = cli.RunContext(context.Background(), &client.Task{Name: "hello"})
+	if !errors.Is(err, client.ErrJobFailed) {
+		t.Fatalf("expected ErrJobFailed, got %v", err)
+	}
+	if result == nil || result.Status != base.FAILURE {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	if _, err := cli.RunContext(context.Background(), &client.Task{}); !errors.Is(err, client.ErrInvalidTask) {
+		t.Fatalf("expected ErrInvalidTask, got %v", err)
+	}
+}
+
+func TestRunContextCancelStopsRemoteRun(t *testing.T) {
+	registry := server.NewRegistry()
+	started := make(chan struct{})
+	stopped := make(chan struct{})
+	if err := registry.AddStoppableJob("slow", func(m map[string]string, signature string, quit chan struct{}) bool {
+		close(started)
+		select {
+		case <-quit:
+			close(stopped)
+		case <-time.After(5 * time.Second):
+		}
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add stoppable job: %v", err)
+	}
+
+	socket := tempSocketPath(t, "run-context-cancel")
+	go server.NewServer(&utils.DefaultLogger{}, socket, server.WithRegistry(registry)).Serve()
+	time.Sleep(300 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	result, err := client.NewClient(&utils.DefaultLogger{}, socket).RunContext(ctx, &client.Task{Name: "slow"})
+	if !errors.Is(err, client.ErrInterrupted) {
+		t.Fatalf("expected ErrInterrupted, got %v", err)
+	}
+	if result == nil || result.Status != base.INTERRUPT {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("remote run was not stopped after cancellation")
+	}
+}
+
+func TestRunContextPayload(t *testing.T) {
+	registry := server.NewRegistry()
+	received := make(chan []int, 2)
+	if err := registry.AddRequestJob("reindex", func(req *server.JobRequest) bool {
+		var body struct {
+			IDs []int `json:"ids"`
+		}
+		if err := req.DecodePayload(&body); err != nil {
+			return false
+		}
+		if req.Args["mode"] != "full" || req.ContentType != "application/json" {
+			return false
+		}
+		received <- body.IDs
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add request job: %v", err)
+	}
+
+	socket := tempSocketPath(t, "payload")
+	go server.NewServer(&utils.DefaultLogger{}, socket, server.WithRegistry(registry)).Serve()
+	time.Sleep(300 * time.Millisecond)
+
+	ids := make([]string, 5000)
+	for i := range ids {
+		ids[i] = fmt.Sprint(i)
+	}
+	data := []byte(`{"ids":[` + strings.Join(ids, ",") + `]}`)
+
+	_, err := client.NewClient(&utils.DefaultLogger{}, socket).RunContext(context.Background(), &client.Task{
+		Name:   "reindex",
+		Params: map[string]string{"mode": "full"},
+		Data:   data,
+	})
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	if got := <-received; len(got) != 5000 || got[4999] != 4999 {
+		t.Fatalf("payload not delivered intact, got %d ids", len(got))
+	}
+
+	file := filepath.Join(t.TempDir(), "ids.json")
+	if err := os.WriteFile(file, []byte(`{"ids":[1,2,3]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if code := client.NewCmd(&utils.DefaultLogger{}, socket).Execute([]string{"-name", "reindex", "-param", "mode=full", "-data", "@" + file}); code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+	if got := <-received; len(got) != 3 {
+		t.Fatalf("expected 3 ids from file, got %v", got)
+	}
+}
+
+func TestRunContextResult(t *testing.T) {
+	registry := server.NewRegistry()
+	if err := registry.AddRequestJob("count_orphans", func(req *server.JobRequest) bool {
+		req.SetOutput("scanned", "1000")
+		return req.SetResult(struct {
+			Orphans int `json:"orphans"`
+		}{Orphans: 7}) == nil
+	}); err != nil {
+		t.Fatalf("failed to add request job: %v", err)
+	}
+
+	socket := tempSocketPath(t, "result")
+	go server.NewServer(&utils.DefaultLogger{}, socket, server.WithRegistry(registry)).Serve()
+	time.Sleep(300 * time.Millisecond)
+
+	result, err := client.NewClient(&utils.DefaultLogger{}, socket).RunContext(context.Background(), &client.Task{Name: "count_orphans"})
+	if err != nil {
+		t.Fatalf("expected success, got %v", err)
+	}
+	var value struct {
+		Orphans int `json:"orphans"`
+	}
+	if err := result.Decode(&value); err != nil || value.Orphans != 7 {
+		t.Fatalf("unexpected result value %s (%v)", result.Value, err)
+	}
+	if result.Outputs["scanned"] != "1000" {
+		t.Fatalf("unexpected outputs: %v", result.Outputs)
+	}
+}
+
+func TestRunContextResume(t *testing.T) {
+	registry := server.NewRegistry()
+	if err := registry.AddRequestJob("migrate", func(req *server.JobRequest) bool {
+		cursor, err := req.Checkpoint()
+		if err != nil {
+			return false
+		}
+		if !req.Resumed {
+			return req.SaveCheckpoint([]byte("42")) != nil
+		}
+		req.SetOutput("cursor", string(cursor))
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+
+	socket := tempSocketPath(t, "resume")
+	t.Cleanup(func() { _ = os.RemoveAll(socket + ".checkpoints") })
+	go server.NewServer(&utils.DefaultLogger{}, socket, server.WithRegistry(registry)).Serve()
+	time.Sleep(300 * time.Millisecond)
+
+	cli := client.NewClient(&utils.DefaultLogger{}, socket)
+	first, err := cli.RunContext(context.Background(), &client.Task{Name: "migrate"})
+	if !errors.Is(err, client.ErrJobFailed) {
+		t.Fatalf("expected the first run to fail, got %v", err)
+	}
+	result, err := cli.RunContext(context.Background(), &client.Task{Name: "migrate", Resume: first.Signature})
+	if err != nil || result.Signature != first.Signature || result.Outputs["cursor"] != "42" {
+		t.Fatalf("expected the resumed run to see the checkpoint, got %+v, %v", result, err)
+	}
+}
+
+func TestRunContextLocked(t *testing.T) {
+	lockDir := t.TempDir()
+	started, release := make(chan struct{}), make(chan struct{})
+	replicas := make([]string, 2)
+	for i := range replicas {
+		registry := server.NewRegistry()
+		if err := registry.AddJob("nightly", func(m map[string]string, signature string) bool {
+			close(started)
+			<-release
+			return true
+		}, server.WithLock("", time.Minute)); err != nil {
+			t.Fatalf("failed to add job: %v", err)
+		}
+		replicas[i] = tempSocketPath(t, fmt.Sprintf("locked-%d", i))
+		go server.NewServer(&utils.DefaultLogger{}, replicas[i], server.WithRegistry(registry),
+			server.WithLocker(server.NewFileLocker(lockDir))).Serve()
+	}
+	time.Sleep(300 * time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := client.NewClient(&utils.DefaultLogger{}, replicas[0]).RunContext(context.Background(), &client.Task{Name: "nightly"})
+		done <- err
+	}()
+	<-started
+
+	result, err := client.NewClient(&utils.DefaultLogger{}, replicas[1]).RunContext(context.Background(), &client.Task{Name: "nightly"})
+	if !errors.Is(err, client.ErrLocked) || result.Status != base.LOCKED {
+		t.Fatalf("expected ErrLocked from the second replica, got %+v, %v", result, err)
+	}
+	if code := client.NewCmd(quietLogger{}, replicas[1]).Execute([]string{"--name", "nightly"}); code != 0 {
+		t.Fatalf("a skipped run should exit 0, got %d", code)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("the first replica's run failed: %v", err)
+	}
+}
+
+func TestRunContextIdempotent(t *testing.T) {
+	registry := server.NewRegistry()
+	var mu sync.Mutex
+	runs := 0
+	if err := registry.AddJob("charge", func(m map[string]string, signature string) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		runs++
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+
+	socket := tempSocketPath(t, "idempotent")
+	go server.NewServer(&utils.DefaultLogger{}, socket, server.WithRegistry(registry)).Serve()
+	time.Sleep(300 * time.Millisecond)
+
+	cli := client.NewClient(&utils.DefaultLogger{}, socket)
+	task := &client.Task{Name: "charge", Signature: "order-42"}
+	first, err := cli.RunContext(context.Background(), task)
+	if err != nil || first.Replayed || first.Signature != "order-42" {
+		t.Fatalf("first run failed: %+v, %v", first, err)
+	}
+	retry, err := cli.RunContext(context.Background(), task)
+	if err != nil || !retry.Replayed || retry.Signature != "order-42" {
+		t.Fatalf("the retry should replay the first run: %+v, %v", retry, err)
+	}
+	keyed := &client.Task{Name: "charge", IdempotencyKey: "order-43"}
+	for i := 0; i < 2; i++ {
+		result, err := cli.RunContext(context.Background(), keyed)
+		if err != nil || result.Replayed != (i == 1) {
+			t.Fatalf("run %d with a key: %+v, %v", i+1, result, err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if runs != 2 {
+		t.Fatalf("expected 2 executions, got %d", runs)
+	}
+}
+
+func TestRunContextRetryAfterFailure(t *testing.T) {
+	registry := server.NewRegistry()
+	var runs atomic.Int32
+	if err := registry.AddJob("charge", func(m map[string]string, signature string) bool {
+		runs.Add(1)
+		time.Sleep(300 * time.Millisecond)
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+
+	socket := tempSocketPath(t, "retry-after-failure")
+	go server.NewServer(&utils.DefaultLogger{}, socket, server.WithRegistry(registry)).Serve()
+	time.Sleep(300 * time.Millisecond)
+
+	// no signature and no key: the failed attempt reports the one it generated
+	task := &client.Task{Name: "charge"}
+	impatient := client.NewClient(&utils.DefaultLogger{}, socket, client.WithRequestTimeout(50*time.Millisecond))
+	first, err := impatient.RunContext(context.Background(), task)
+	var runErr *client.RunError
+	if !errors.Is(err, client.ErrTimeout) || !errors.As(err, &runErr) {
+		t.Fatalf("expected the first attempt to time out mid-flight, got %v", err)
+	}
+	if runErr.Signature == "" || first == nil || first.Signature != runErr.Signature {
+		t.Fatalf("the failed attempt should report its signature: %+v, %v", first, err)
+	}
+	if task.Signature != "" {
+		t.Fatalf("the task must not be changed, got signature %s", task.Signature)
+	}
+
+	retry := &client.Task{Name: "charge", Signature: runErr.Signature}
+	result, err := client.NewClient(&utils.DefaultLogger{}, socket).RunContext(context.Background(), retry)
+	if err != nil || !result.Replayed || result.Signature != runErr.Signature {
+		t.Fatalf("the retry should wait for and replay the first run: %+v, %v", result, err)
+	}
+	if n := runs.Load(); n != 1 {
+		t.Fatalf("expected one execution, got %d", n)
+	}
+}
+
+func TestStopWait(t *testing.T) {
+	registry := server.NewRegistry()
+	started, exit := make(chan struct{}, 2), make(chan struct{})
+	if err := registry.AddStoppableJob("drain", func(m map[string]string, signature string, quit chan struct{}) bool {
+		started <- struct{}{}
+		<-quit
+		if m["stubborn"] == "true" {
+			<-exit
+		}
+		return false
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	defer close(exit)
+
+	socket := tempSocketPath(t, "stop-wait")
+	go server.NewServer(&utils.DefaultLogger{}, socket, server.WithRegistry(registry)).Serve()
+	time.Sleep(300 * time.Millisecond)
+
+	cli := client.NewClient(&utils.DefaultLogger{}, socket)
+	run := func(task *client.Task) <-chan error {
+		done := make(chan error, 1)
+		go func() {
+			_, err := cli.RunContext(context.Background(), task)
+			done <- err
+		}()
+		<-started
+		return done
+	}
+
+	done := run(&client.Task{Name: "drain", Signature: "d-1"})
+	result, err := cli.RunContext(context.Background(), &client.Task{Name: "drain", Stop: true, Signature: "d-1", StopWait: time.Second})
+	if err != nil || result.State != base.RunStopped {
+		t.Fatalf("the stop should confirm the run exited: %+v, %v", result, err)
+	}
+	if err := <-done; !errors.Is(err, client.ErrInterrupted) {
+		t.Fatalf("expected the run to be interrupted, got %v", err)
+	}
+
+	done = run(&client.Task{Name: "drain", Signature: "d-2", Params: map[string]string{"stubborn": "true"}})
+	_, err = cli.RunContext(context.Background(), &client.Task{Name: "drain", Stop: true, Signature: "d-2", StopWait: 50 * time.Millisecond})
+	if !errors.Is(err, client.ErrStopUnresponsive) {
+		t.Fatalf("expected an unresponsive run, got %v", err)
+	}
+	result, err = cli.RunContext(context.Background(), &client.Task{Name: "drain", Stop: true, Signature: "d-2", StopForce: true})
+	if err != nil || result.State != base.RunAbandoned {
+		t.Fatalf("a forced stop should abandon the run: %+v, %v", result, err)
+	}
+	if err := <-done; !errors.Is(err, client.ErrInterrupted) {
+		t.Fatalf("expected the abandoned run to be reported as interrupted, got %v", err)
+	}
+}
+
+func TestContextJobFollowsCaller(t *testing.T) {
+	registry := server.NewRegistry()
+	started, exit := make(chan struct{}, 1), make(chan struct{})
+	cancelled := make(chan string, 1)
+	if err := registry.AddJob("plain", func(map[string]string, string) bool {
+		started <- struct{}{}
+		<-exit
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	if err := registry.AddContextJob("export", func(ctx context.Context, _ map[string]string, signature string) bool {
+		started <- struct{}{}
+		<-ctx.Done()
+		cancelled <- signature
+		return false
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+
+	socket := tempSocketPath(t, "context-job")
+	go server.NewServer(&utils.DefaultLogger{}, socket, server.WithRegistry(registry)).Serve()
+	time.Sleep(300 * time.Millisecond)
+
+	cli := client.NewClient(&utils.DefaultLogger{}, socket)
+	done := make(chan error, 1)
+	go func() {
+		_, err := cli.RunContext(context.Background(), &client.Task{Name: "plain", Signature: "p-1"})
+		done <- err
+	}()
+	<-started
+	if _, err := cli.RunContext(context.Background(), &client.Task{Name: "plain", Stop: true, Signature: "p-1"}); !errors.Is(err, client.ErrNotStoppable) {
+		t.Fatalf("expected the plain job to be not stoppable, got %v", err)
+	}
+	close(exit)
+	if err := <-done; err != nil {
+		t.Fatalf("the plain run should finish: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		_, err := cli.RunContext(ctx, &client.Task{Name: "export", Signature: "e-1"})
+		done <- err
+	}()
+	<-started
+	cancel()
+	if err := <-done; !errors.Is(err, client.ErrInterrupted) {
+		t.Fatalf("expected the run to be interrupted, got %v", err)
+	}
+	select {
+	case signature := <-cancelled:
+		if signature != "e-1" {
+			t.Fatalf("unexpected run cancelled: %s", signature)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the handler's context was not cancelled when the caller went away")
+	}
+}
+
+func TestLocalTransport(t *testing.T) {
+	registry := server.NewRegistry()
+	started, stopped := make(chan struct{}), make(chan struct{})
+	if err := registry.AddJob("hello", func(m map[string]string, signature string) bool {
+		return m["ok"] == "true"
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	if err := registry.AddStoppableJob("slow", func(m map[string]string, signature string, quit chan struct{}) bool {
+		close(started)
+		<-quit
+		close(stopped)
+		return false
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+
+	// no socket: the client calls the server's handler over in-memory pipes
+	local := server.NewServer(&utils.DefaultLogger{}, "", server.WithRegistry(registry)).ServeLocal()
+	defer local.Close()
+	cli := client.NewClient(&utils.DefaultLogger{}, "", client.WithDialer(local.DialContext))
+
+	result, err := cli.RunContext(context.Background(), &client.Task{Name: "hello", Params: map[string]string{"ok": "true"}})
+	if err != nil || result.Status != base.SUCCESS {
+		t.Fatalf("expected success, got %+v, %v", result, err)
+	}
+	if jobs, err := cli.ListJobs(context.Background()); err != nil || len(jobs) != 2 {
+		t.Fatalf("expected both jobs to be listed, got %+v, %v", jobs, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	if _, err := cli.RunContext(ctx, &client.Task{Name: "slow"}); !errors.Is(err, client.ErrInterrupted) {
+		t.Fatalf("expected ErrInterrupted, got %v", err)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(2 * time.Second):
+		t.Fatal("remote run was not stopped after cancellation")
+	}
+
+	cmd := client.NewCmd(&utils.DefaultLogger{}, "", client.WithDialer(local.DialContext))
+	if code := cmd.Execute([]string{"-name", "hello", "-param", "ok=true"}); code != 0 {
+		t.Fatalf("expected the CLI to succeed in memory, got exit code %d", code)
+	}
+	if code := cmd.Execute([]string{"-name", "missing"}); code != 1 {
+		t.Fatalf("expected exit code 1 for missing job, got %d", code)
+	}
+}
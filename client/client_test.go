@@ -0,0 +1,115 @@
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/client"
+	"github.com/Kingson4Wu/saturncli/server"
+)
+
+func TestClientConcurrentRuns(t *testing.T) {
+	registry := server.NewRegistry()
+	if err := registry.AddJob("hello", func(m map[string]string, signature string) bool {
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+
+	socket := tempSocketPath(t, "concurrent")
+	go server.NewServer(quietLogger{}, socket, server.WithRegistry(registry)).Serve()
+	time.Sleep(300 * time.Millisecond)
+
+	cli := client.NewClient(quietLogger{}, socket, client.WithMaxIdleConns(4), client.WithRequestTimeout(5*time.Second))
+	errs := make(chan error, 64)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := cli.RunContext(context.Background(), &client.Task{Name: "hello"})
+			errs <- err
+		}()
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("concurrent run failed: %v", err)
+		}
+	}
+}
+
+func startBenchServer(b *testing.B) string {
+	b.Helper()
+	registry := server.NewRegistry()
+	_ = registry.AddJob("hello", func(m map[string]string, signature string) bool {
+		return true
+	})
+	socket := filepath.Join(os.TempDir(), fmt.Sprintf("saturncli-bench-%d.sock", time.Now().UnixNano()))
+	go server.NewServer(quietLogger{}, socket, server.WithRegistry(registry)).Serve()
+	time.Sleep(300 * time.Millisecond)
+	return socket
+}
+
+// BenchmarkRunClientPerCall mirrors callers that build a client, and with it a
+// transport, for every run; no connection is ever reused.
+func BenchmarkRunClientPerCall(b *testing.B) {
+	socket := startBenchServer(b)
+	task := &client.Task{Name: "hello", Args: "id=45&tel=48893"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cli := client.NewClient(quietLogger{}, socket)
+		if _, err := cli.RunContext(context.Background(), task); err != nil {
+			b.Fatal(err)
+		}
+		cli.CloseIdleConnections()
+	}
+}
+
+func BenchmarkRunSharedClient(b *testing.B) {
+	socket := startBenchServer(b)
+	cli := client.NewClient(quietLogger{}, socket)
+	task := &client.Task{Name: "hello", Args: "id=45&tel=48893"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := cli.RunContext(context.Background(), task); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParallelRunSharedClient(b *testing.B) {
+	socket := startBenchServer(b)
+	cli := client.NewClient(quietLogger{}, socket, client.WithMaxIdleConns(64))
+	task := &client.Task{Name: "hello", Args: "id=45&tel=48893"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := cli.RunContext(context.Background(), task); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// quietLogger keeps benchmark output readable.
+type quietLogger struct{}
+
+func (quietLogger) Debugf(string, ...interface{}) {}
+
+func (quietLogger) Infof(string, ...interface{}) {}
+
+func (quietLogger) Warnf(string, ...interface{}) {}
+
+func (quietLogger) Errorf(string, ...interface{}) {}
+
+func (quietLogger) Debug(...interface{}) {}
+
+func (quietLogger) Info(...interface{}) {}
+
+func (quietLogger) Warn(...interface{}) {}
+
+func (quietLogger) Error(...interface{}) {}
@@ -2,12 +2,21 @@
 
 package client
 
-import "net/http"
+import (
+	"net"
+	"net/http"
+)
 
 func (c *cli) buildHTTPClient() *http.Client {
-	return &http.Client{Timeout: defaultRequestTimeout}
+	dialer := &net.Dialer{Timeout: c.dialTimeout}
+	return &http.Client{
+		Timeout:   c.requestTimeout,
+		Transport: c.newTransport(dialer.DialContext),
+	}
 }
 
+const transportHost = "127.0.0.1:8096"
+
 func (task *Task) buildURL() (string, error) {
-	return task.buildURLForHost("127.0.0.1:8096")
+	return task.buildURLForHost(transportHost)
 }
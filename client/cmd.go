@@ -1,87 +1,231 @@
 package client
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
 	"github.com/Kingson4Wu/saturncli/base"
 	"github.com/Kingson4Wu/saturncli/utils"
 	"io"
+	"net/url"
 	"os"
 	"sort"
 	"strings"
+	"time"
 )
 
-// NewCmd constructs a CLI command wrapper bound to the provided logger and socket path.
-func NewCmd(logger utils.Logger, sockPath string) *cmd {
+// NewCmd constructs a CLI command wrapper bound to the provided logger and
+// socket path. opts are applied to every client the commands create, such as
+// WithDialer to run the CLI against a server in the same process.
+func NewCmd(logger utils.Logger, sockPath string, opts ...ClientOption) *cmd {
 	return &cmd{
 		logger:   logger,
 		sockPath: sockPath,
+		opts:     opts,
 	}
 }
 
 type cmd struct {
 	logger   utils.Logger
 	sockPath string
+	opts     []ClientOption
+}
+
+// newClient creates a client for one command, with the options given to
+// NewCmd followed by opts.
+func (c *cmd) newClient(opts ...ClientOption) *cli {
+	all := make([]ClientOption, 0, len(c.opts)+len(opts))
+	all = append(append(all, c.opts...), opts...)
+	return NewClient(c.logger, c.sockPath, all...)
 }
 
 func (c *cmd) Run() {
 	c.RunWithArgs(os.Args[1:])
 }
 
+// RunWithArgs executes the command line and exits the process with status 1
+// on failure. Use Execute to keep the process alive.
 func (c *cmd) RunWithArgs(arguments []string) {
+	if code := c.Execute(arguments); code != 0 {
+		os.Exit(code)
+	}
+}
+
+// Execute runs the command line and returns the exit code instead of exiting.
+// Signals received while a job runs interrupt it and stop the remote run.
+func (c *cmd) Execute(arguments []string) int {
+	if len(arguments) > 0 {
+		switch arguments[0] {
+		case completionCommand:
+			return c.runCompletion(arguments[1:])
+		case completeCommand:
+			return c.runComplete(arguments[1:])
+		case eventsCommand:
+			return c.runEvents(arguments[1:])
+		case listCommand:
+			return c.runList(arguments[1:])
+		case psCommand:
+			return c.runPs(arguments[1:])
+		case pauseCommand, resumeCommand:
+			return c.runControl(arguments[0], arguments[1:])
+		case disableCommand, enableCommand:
+			return c.runToggle(arguments[0], arguments[1:])
+		case queueCommand:
+			return c.runQueue(arguments[1:])
+		case runCommand:
+			arguments = arguments[1:]
+		case stopCommand:
+			arguments = append([]string{"--stop"}, arguments[1:]...)
+		}
+	}
+
 	opts, err := c.parse(arguments)
 	if err != nil {
 		c.logger.Errorf("saturn client parse arguments failure: %+v", err)
 		fmt.Fprintln(os.Stderr, "Execution Failure")
-		os.Exit(1)
-		return
+		return 1
 	}
 	if opts == nil {
-		return
+		return 0
+	}
+
+	if opts.batch != "" {
+		return c.executeBatch(opts)
+	}
+
+	if opts.stop && opts.signature == "" && (strings.ContainsAny(opts.name, "*?[") || len(opts.params) > 0 || opts.startedBy != "" || opts.olderThan > 0) {
+		return c.executeStopMatching(opts)
 	}
 
 	c.logger.Infof("saturn client cmd task: %s, args:%s, params:%v", opts.name, opts.args, opts.params)
 
-	result := NewClient(c.logger,
-		c.sockPath).Run(&Task{
-		Name:      opts.name,
-		Args:      opts.args,
-		Stop:      opts.stop,
-		Signature: opts.signature,
-		Params:    cloneStringMap(opts.params),
+	params := cloneStringMap(opts.params)
+	if opts.multi {
+		// every value, including the last one, travels in Values
+		params = nil
+	}
+
+	data, err := readData(opts.data)
+	if err != nil {
+		c.logger.Errorf("saturn client read data failure: %+v", err)
+		fmt.Fprintln(os.Stderr, "Execution Failure")
+		return 1
+	}
+
+	reportQueued := WithQueuePosition(func(run base.QueuedRun) {
+		fmt.Fprintf(os.Stderr, "Queued at position %d\n", run.Position)
 	})
+	result, err := c.newClient(WithSignalHandling(), reportQueued, WithRateLimitWait(opts.rateLimitWait),
+		WithCallerToken(opts.callerToken)).RunContext(context.Background(), &Task{
+		Name:           opts.name,
+		Args:           opts.args,
+		Stop:           opts.stop,
+		Signature:      opts.signature,
+		IdempotencyKey: opts.idempotency,
+		Params:         params,
+		Values:         opts.values,
+		MultiValue:     opts.multi,
+		Data:           data,
+		ContentType:    opts.contentType,
+		Resume:         opts.resume,
+		Priority:       opts.priority,
+		StopWait:       opts.wait,
+		StopForce:      opts.force,
+		StopReason:     opts.reason,
+	})
+
+	if result != nil {
+		writeResult(os.Stdout, result)
+	}
 
-	switch result {
-	case base.SUCCESS:
+	switch {
+	case err == nil && result.Replayed:
+		fmt.Fprintln(os.Stderr, "Execution Success (replayed)")
+	case err == nil && result.State != "":
+		fmt.Fprintf(os.Stderr, "Execution Success (%s)\n", result.State)
+	case err == nil:
 		fmt.Fprintln(os.Stderr, "Execution Success")
-	case base.INTERRUPT:
+	case errors.Is(err, ErrInterrupted):
 		fmt.Fprintln(os.Stderr, "Execution Interrupted")
+	case errors.Is(err, ErrLocked):
+		// another replica is running the job, which is what once-per-cluster jobs want
+		fmt.Fprintf(os.Stderr, "Execution Skipped: %s\n", result.Message)
+	case errors.Is(err, ErrJobDisabled), errors.Is(err, ErrQueueFull), errors.Is(err, ErrRateLimited), errors.Is(err, ErrStopUnresponsive), errors.Is(err, ErrNotStoppable):
+		fmt.Fprintf(os.Stderr, "Execution Failure: %s\n", result.Message)
+		return 1
 	default:
 		fmt.Fprintln(os.Stderr, "Execution Failure")
-		os.Exit(1)
+		return 1
 	}
+	return 0
 }
 
+const (
+	runCommand = "run"
+	// stopCommand is run with --stop.
+	stopCommand = "stop"
+)
+
 type cmdOptions struct {
-	name      string
-	args      string
-	stop      bool
-	signature string
-	params    map[string]string
+	name        string
+	args        string
+	stop        bool
+	signature   string
+	idempotency string
+	params      map[string]string
+	batch       string
+	concurrency int
+	data        string
+	contentType string
+	multi       bool
+	values      url.Values
+	resume      string
+	priority    int
+	wait        time.Duration
+	force       bool
+	reason      string
+	startedBy   string
+	olderThan   time.Duration
+
+	rateLimitWait time.Duration
+	callerToken   string
 }
 
-func (c *cmd) parse(arguments []string) (*cmdOptions, error) {
-	opts := &cmdOptions{}
+// newRunFlagSet declares the flags accepted when running or stopping a job.
+func newRunFlagSet(opts *cmdOptions, paramFlag *keyValueFlag) *flag.FlagSet {
 	fs := flag.NewFlagSet("saturn-cli", flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
 
 	fs.StringVar(&opts.name, "name", "", "Input Job Name")
 	fs.StringVar(&opts.args, "args", "", "Input Job Args")
 	fs.BoolVar(&opts.stop, "stop", false, "Input Job Stop Flag")
-	fs.StringVar(&opts.signature, "signature", "", "Input Job Stop Signature")
+	fs.StringVar(&opts.signature, "signature", "", "Signature of the run, or of the run to stop")
+	fs.DurationVar(&opts.wait, "wait", 0, "With --stop, wait up to this long for the runs to exit")
+	fs.BoolVar(&opts.force, "force", false, "With --stop, abandon runs that have not exited when the wait is over")
+	fs.StringVar(&opts.reason, "reason", "", "With --stop, why the runs are stopped; handlers and history get it")
+	fs.StringVar(&opts.startedBy, "started-by", "", "With --stop, only runs started with this caller token or uid")
+	fs.DurationVar(&opts.olderThan, "older-than", 0, "With --stop, only runs started longer ago than this")
+	fs.StringVar(&opts.idempotency, "idempotency-key", "", "Replay the earlier run with this key instead of running again (default the signature)")
+	fs.Var(paramFlag, "param", "Key=Value pair to include in request; can be repeated")
+	fs.BoolVar(&opts.multi, "multi", false, "Keep every value of a repeated --param key instead of the last one")
+	fs.StringVar(&opts.batch, "batch", "", "Run once per parameter set read from a CSV or JSON-lines file, - for stdin")
+	fs.IntVar(&opts.concurrency, "concurrency", 1, "Maximum batch items run at the same time")
+	fs.StringVar(&opts.data, "data", "", "Request body: literal text, @file to read a file, or - for stdin")
+	fs.StringVar(&opts.contentType, "content-type", "", "Media type of --data (default application/json)")
+	fs.StringVar(&opts.resume, "resume", "", "Signature of an interrupted run to continue from its checkpoint")
+	fs.IntVar(&opts.priority, "priority", 0, "Position the run ahead of lower priorities in a server-side queue")
+	fs.DurationVar(&opts.rateLimitWait, "rate-limit-wait", defaultCLIRateLimitWait, "How long to wait out rate limits before giving up, 0 to fail at once")
+	fs.StringVar(&opts.callerToken, "caller-token", "", "Identify this caller to per-caller rate limits")
+	return fs
+}
+
+func (c *cmd) parse(arguments []string) (*cmdOptions, error) {
+	opts := &cmdOptions{}
 	var paramFlag keyValueFlag
-	fs.Var(&paramFlag, "param", "Key=Value pair to include in request; can be repeated")
+	fs := newRunFlagSet(opts, &paramFlag)
 
 	usage := func() {
 		fmt.Fprint(os.Stderr, `
@@ -89,6 +233,23 @@ func (c *cmd) parse(arguments []string) (*cmdOptions, error) {
 2. Input Job Args
 3. Input Job Stop Flag
 
+Commands:
+  run                        Run a job (default when no command is given)
+  stop --name [--signature] [--wait] [--force] [--reason]
+                             Stop runs of a job, the same as run --stop
+  stop --name PATTERN [--param] [--started-by] [--older-than] [--reason]
+                             Stop the runs matching every filter given
+  list [PATTERN] [--tag] [--all]
+                             List registered jobs matching PATTERN, such as billing.*
+  events [--name] [--follow] Print job lifecycle events, streaming with --follow
+  ps [--name]                List runs in flight, queued ones included, and their state
+  pause --name --signature   Ask a run to pause at its next checkpoint
+  resume --name --signature  Let a paused run continue
+  disable NAME [--reason]    Make a job reject runs until it is enabled
+  enable NAME                Let a disabled job run again
+  queue                      Show queue classes, their depth and the runs waiting
+  completion bash|zsh|fish   Print a shell completion script
+
 Options:
 `)
 		fs.SetOutput(os.Stderr)
@@ -112,13 +273,84 @@ Options:
 	}
 
 	opts.params = cloneStringMap(paramFlag.values)
+	if opts.multi {
+		opts.values = paramFlag.all()
+	}
+
+	if opts.batch != "" && opts.stop {
+		usage()
+		return nil, errors.New("--batch cannot be combined with --stop")
+	}
+	if opts.batch != "" && opts.data != "" {
+		usage()
+		return nil, errors.New("--batch cannot be combined with --data")
+	}
+	if opts.resume != "" && (opts.stop || opts.batch != "") {
+		usage()
+		return nil, errors.New("--resume cannot be combined with --stop or --batch")
+	}
 
 	return opts, nil
 }
 
-// keyValueFlag collects repeated --param flags into a map.
+// writeResult prints the value and outputs a handler returned: text and
+// bytes verbatim, JSON indented, then outputs as sorted key=value lines.
+func writeResult(w io.Writer, result *Result) {
+	if len(result.Value) > 0 {
+		value := result.Value
+		if result.ValueType == base.ResultJSON {
+			var indented bytes.Buffer
+			if err := json.Indent(&indented, value, "", "  "); err == nil {
+				value = indented.Bytes()
+			}
+		}
+		_, _ = w.Write(value)
+		if result.ValueType != base.ResultBytes && !bytes.HasSuffix(value, []byte("\n")) {
+			fmt.Fprintln(w)
+		}
+	}
+	keys := make([]string, 0, len(result.Outputs))
+	for k := range result.Outputs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s=%s\n", k, result.Outputs[k])
+	}
+}
+
+// readData resolves the --data flag the way curl does: "-" reads stdin,
+// "@path" reads a file and anything else is sent verbatim.
+func readData(value string) ([]byte, error) {
+	switch {
+	case value == "":
+		return nil, nil
+	case value == "-":
+		return io.ReadAll(os.Stdin)
+	case strings.HasPrefix(value, "@"):
+		return os.ReadFile(strings.TrimPrefix(value, "@"))
+	default:
+		return []byte(value), nil
+	}
+}
+
+// keyValueFlag collects repeated --param flags into a map, where the last
+// value of a key wins, and keeps every pair in order for --multi.
 type keyValueFlag struct {
-	values map[string]string
+	values  map[string]string
+	ordered [][2]string
+}
+
+// all returns every collected value per key, in the order given.
+func (f *keyValueFlag) all() url.Values {
+	if len(f.ordered) == 0 {
+		return nil
+	}
+	out := url.Values{}
+	for _, pair := range f.ordered {
+		out.Add(pair[0], pair[1])
+	}
+	return out
 }
 
 func (f *keyValueFlag) String() string {
@@ -149,6 +381,7 @@ func (f *keyValueFlag) Set(value string) error {
 		f.values = make(map[string]string)
 	}
 	f.values[key] = pieces[1]
+	f.ordered = append(f.ordered, [2]string{key, pieces[1]})
 	return nil
 }
 
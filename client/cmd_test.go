@@ -7,6 +7,7 @@ import (
 	"github.com/Kingson4Wu/saturncli/utils"
 	"os"
 	"path/filepath"
+	"reflect"
 	"sync"
 	"testing"
 	"time"
@@ -150,3 +151,49 @@ func tempSocketPath(t *testing.T, name string) string {
 	t.Helper()
 	return filepath.Join(os.TempDir(), fmt.Sprintf("saturncli-%s-%d.sock", name, time.Now().UnixNano()))
 }
+
+func TestExecuteReturnsExitCode(t *testing.T) {
+	socket := tempSocketPath(t, "execute")
+	go server.NewServer(&utils.DefaultLogger{}, socket, server.WithRegistry(server.NewRegistry())).Serve()
+	time.Sleep(300 * time.Millisecond)
+
+	cmd := client.NewCmd(&utils.DefaultLogger{}, socket)
+	if code := cmd.Execute([]string{"-name", "missing"}); code != 1 {
+		t.Fatalf("expected exit code 1 for missing job, got %d", code)
+	}
+	if code := cmd.Execute([]string{"-unknown"}); code != 1 {
+		t.Fatalf("expected exit code 1 for bad flag, got %d", code)
+	}
+}
+
+func TestMultiValueParams(t *testing.T) {
+	registry := server.NewRegistry()
+	received := make(chan *server.JobRequest, 1)
+	if err := registry.AddRequestJob("shards", func(req *server.JobRequest) bool {
+		received <- req
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add request job: %v", err)
+	}
+
+	socket := tempSocketPath(t, "multi")
+	go server.NewServer(&utils.DefaultLogger{}, socket, server.WithRegistry(registry)).Serve()
+	time.Sleep(300 * time.Millisecond)
+
+	code := client.NewCmd(&utils.DefaultLogger{}, socket).Execute([]string{
+		"-name", "shards", "-multi", "-param", "shard=2", "-param", "shard=1", "-args", "shard=9&env=dev&env=prod",
+	})
+	if code != 0 {
+		t.Fatalf("expected exit code 0, got %d", code)
+	}
+	req := <-received
+	if got := req.All("shard"); !reflect.DeepEqual(got, []string{"2", "1"}) {
+		t.Fatalf("expected shard values [2 1], got %v", got)
+	}
+	if got := req.All("env"); !reflect.DeepEqual(got, []string{"dev", "prod"}) {
+		t.Fatalf("expected env values [dev prod], got %v", got)
+	}
+	if req.Args["shard"] != "2" || req.Get("env") != "dev" {
+		t.Fatalf("expected first values in Args, got %v", req.Args)
+	}
+}
@@ -0,0 +1,317 @@
+package client
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+)
+
+const (
+	completionCommand = "completion"
+	// completeCommand is the hidden entry point the generated scripts call back into.
+	completeCommand = "__complete"
+
+	completeRequestTimeout = 2 * time.Second
+)
+
+var completionShells = []string{"bash", "zsh", "fish"}
+
+// subcommands are offered when completing the first word.
+var subcommands = []string{runCommand, stopCommand, listCommand, eventsCommand, psCommand, pauseCommand, resumeCommand, disableCommand, enableCommand, queueCommand, completionCommand}
+
+func isSubcommand(word string) bool {
+	for _, command := range subcommands {
+		if word == command {
+			return true
+		}
+	}
+	return false
+}
+
+// commandFlagSet returns the flags accepted by command.
+func commandFlagSet(command string) *flag.FlagSet {
+	switch command {
+	case listCommand:
+		return newListFlagSet(&listOptions{})
+	case eventsCommand:
+		return newEventsFlagSet(&eventsOptions{})
+	case psCommand:
+		return newPsFlagSet(&runControlOptions{})
+	case pauseCommand, resumeCommand:
+		return newRunControlFlagSet(command, &runControlOptions{})
+	case disableCommand, enableCommand:
+		return newToggleFlagSet(command, &toggleOptions{})
+	case queueCommand:
+		return newQueueFlagSet()
+	default:
+		return newRunFlagSet(&cmdOptions{}, &keyValueFlag{})
+	}
+}
+
+func (c *cmd) runCompletion(arguments []string) int {
+	if len(arguments) != 1 {
+		fmt.Fprintf(os.Stderr, "usage: %s completion bash|zsh|fish\n", programName())
+		return 1
+	}
+	script, err := completionScript(arguments[0], programName())
+	if err != nil {
+		c.logger.Errorf("saturn client completion failure: %+v", err)
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Fprint(os.Stdout, script)
+	return 0
+}
+
+func (c *cmd) runComplete(words []string) int {
+	ctx, cancel := context.WithTimeout(context.Background(), completeRequestTimeout)
+	defer cancel()
+	for _, candidate := range c.completionCandidates(ctx, words) {
+		fmt.Fprintln(os.Stdout, candidate)
+	}
+	return 0
+}
+
+func programName() string {
+	return filepath.Base(os.Args[0])
+}
+
+// completionScript renders the completion script for shell. The scripts only
+// forward the words typed so far to the hidden __complete command, so job names
+// and parameters always reflect what the server currently has registered.
+func completionScript(shell, prog string) (string, error) {
+	fn := "_" + strings.NewReplacer("-", "_", ".", "_").Replace(prog)
+	switch shell {
+	case "bash":
+		return fmt.Sprintf(`# bash completion for %[1]s
+%[2]s() {
+    local line="${COMP_LINE:0:COMP_POINT}"
+    local -a words
+    read -r -a words <<< "$line"
+    [[ "$line" == *" " ]] && words+=("")
+    local cur="${words[${#words[@]}-1]}"
+    local IFS=$'\n'
+    COMPREPLY=( $(compgen -W "$("${words[0]}" %[3]s "${words[@]:1}" 2>/dev/null)" -- "$cur") )
+    if [[ ${#COMPREPLY[@]} -eq 1 && "${COMPREPLY[0]}" == *= ]]; then
+        compopt -o nospace 2>/dev/null
+    fi
+    # bash breaks words on '=', so only hand back what follows it.
+    if [[ "$cur" == *=* && "$COMP_WORDBREAKS" == *=* ]]; then
+        COMPREPLY=( "${COMPREPLY[@]#"${cur%%=*}="}" )
+    fi
+}
+complete -o default -F %[2]s %[1]s
+`, prog, fn, completeCommand), nil
+	case "zsh":
+		return fmt.Sprintf(`#compdef %[1]s
+%[2]s() {
+    local -a candidates
+    candidates=("${(@f)$(${words[1]} %[3]s "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    compadd -Q -S '' -- "${candidates[@]}"
+}
+compdef %[2]s %[1]s
+`, prog, fn, completeCommand), nil
+	case "fish":
+		return fmt.Sprintf(`# fish completion for %[1]s
+function _%[2]s
+    set -l tokens (commandline -opc)
+    $tokens[1] %[3]s $tokens[2..-1] (commandline -ct) 2>/dev/null
+end
+complete -c %[1]s -f -a '(_%[2]s)'
+`, prog, fn[1:], completeCommand), nil
+	default:
+		return "", fmt.Errorf("unsupported shell %q, expect one of %s", shell, strings.Join(completionShells, ", "))
+	}
+}
+
+// completionCandidates returns the suggestions for the last element of words,
+// which is the (possibly empty) word being completed.
+func (c *cmd) completionCandidates(ctx context.Context, words []string) []string {
+	cur := ""
+	if len(words) > 0 {
+		cur = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+	prev := ""
+	if len(words) > 0 {
+		prev = words[len(words)-1]
+	}
+
+	if len(words) == 1 && prev == completionCommand {
+		return filterPrefix(completionShells, cur)
+	}
+
+	command := runCommand
+	if len(words) > 0 && isSubcommand(words[0]) {
+		command = words[0]
+	}
+	fs := commandFlagSet(command)
+
+	if len(words) == 1 && (command == disableCommand || command == enableCommand) && !strings.HasPrefix(cur, "-") {
+		return c.flagValueCandidates(ctx, "name", words, cur)
+	}
+
+	if name, ok := flagName(fs, prev); ok {
+		return c.flagValueCandidates(ctx, name, words, cur)
+	}
+
+	if strings.HasPrefix(cur, "-") {
+		if name, value, ok := strings.Cut(cur, "="); ok {
+			flagPrefix := name + "="
+			values := c.flagValueCandidates(ctx, strings.TrimLeft(name, "-"), words, value)
+			for i := range values {
+				values[i] = flagPrefix + values[i]
+			}
+			return values
+		}
+		var flags []string
+		fs.VisitAll(func(f *flag.Flag) {
+			flags = append(flags, "--"+f.Name)
+		})
+		return filterPrefix(flags, cur)
+	}
+
+	if len(words) == 0 {
+		return filterPrefix(subcommands, cur)
+	}
+	return nil
+}
+
+func (c *cmd) flagValueCandidates(ctx context.Context, name string, words []string, cur string) []string {
+	switch name {
+	case "name":
+		jobs := c.completionJobs(ctx)
+		names := make([]string, 0, len(jobs))
+		for _, job := range jobs {
+			names = append(names, job.Name)
+		}
+		return filterPrefix(names, cur)
+	case "param":
+		return filterPrefix(paramCandidates(c.completionJobs(ctx), typedJobName(words), cur), cur)
+	case "signature":
+		var signatures []string
+		jobName := typedJobName(words)
+		for _, job := range c.completionJobs(ctx) {
+			if jobName == "" || job.Name == jobName {
+				signatures = append(signatures, job.Running...)
+			}
+		}
+		return filterPrefix(signatures, cur)
+	case "tag":
+		seen := map[string]bool{}
+		var tags []string
+		for _, job := range c.completionJobs(ctx) {
+			for _, tag := range job.Tags {
+				if !seen[tag] {
+					seen[tag] = true
+					tags = append(tags, tag)
+				}
+			}
+		}
+		sort.Strings(tags)
+		return filterPrefix(tags, cur)
+	default:
+		return nil
+	}
+}
+
+func (c *cmd) completionJobs(ctx context.Context) []base.JobInfo {
+	jobs, err := c.newClient().ListJobs(ctx)
+	if err != nil {
+		c.logger.Warnf("saturn client completion failed to list jobs: %v", err)
+		return nil
+	}
+	return jobs
+}
+
+// paramCandidates offers "key=" for declared keys, or "key=value" for the
+// enum values of key once the user has typed the separator.
+func paramCandidates(jobs []base.JobInfo, jobName, cur string) []string {
+	key, _, typedValue := strings.Cut(cur, "=")
+	seen := map[string]struct{}{}
+	var out []string
+	add := func(candidate string) {
+		if _, ok := seen[candidate]; ok {
+			return
+		}
+		seen[candidate] = struct{}{}
+		out = append(out, candidate)
+	}
+	for _, job := range jobs {
+		if jobName != "" && job.Name != jobName {
+			continue
+		}
+		for _, param := range job.Params {
+			if !typedValue {
+				add(param.Name + "=")
+				continue
+			}
+			if param.Name != key {
+				continue
+			}
+			for _, value := range param.Values {
+				add(param.Name + "=" + value)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// typedJobName finds the value already given to --name, if any.
+func typedJobName(words []string) string {
+	for i, word := range words {
+		name, value, hasValue := strings.Cut(word, "=")
+		if flagNameOf(name) != "name" {
+			continue
+		}
+		if hasValue {
+			return value
+		}
+		if i+1 < len(words) {
+			return words[i+1]
+		}
+	}
+	return ""
+}
+
+// flagName reports whether word is a complete value-taking flag of fs such
+// as --name, meaning the word after it is that flag's value.
+func flagName(fs *flag.FlagSet, word string) (string, bool) {
+	if strings.Contains(word, "=") {
+		return "", false
+	}
+	name := flagNameOf(word)
+	f := fs.Lookup(name)
+	if name == "" || f == nil {
+		return "", false
+	}
+	if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+		return "", false
+	}
+	return name, true
+}
+
+func flagNameOf(word string) string {
+	if !strings.HasPrefix(word, "-") {
+		return ""
+	}
+	return strings.TrimLeft(word, "-")
+}
+
+func filterPrefix(candidates []string, prefix string) []string {
+	var out []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, prefix) {
+			out = append(out, candidate)
+		}
+	}
+	return out
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/server"
+	"github.com/Kingson4Wu/saturncli/utils"
+)
+
+func TestCompletionScript(t *testing.T) {
+	for _, shell := range completionShells {
+		script, err := completionScript(shell, "saturn_cli")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", shell, err)
+		}
+		if !strings.Contains(script, "saturn_cli") || !strings.Contains(script, completeCommand) {
+			t.Fatalf("%s: script does not call back into the cli:\n%s", shell, script)
+		}
+	}
+	if _, err := completionScript("powershell", "saturn_cli"); err == nil {
+		t.Fatal("expected error for unsupported shell")
+	}
+}
+
+func TestCompletionCandidates(t *testing.T) {
+	registry := server.NewRegistry()
+	if err := registry.AddJob("hello", func(m map[string]string, signature string) bool {
+		return true
+	}, server.WithParam("env", "dev", "prod"), server.WithParam("id")); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	started := make(chan struct{})
+	if err := registry.AddStoppableJob("hello_stoppable", func(m map[string]string, signature string, quit chan struct{}) bool {
+		close(started)
+		<-quit
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add stoppable job: %v", err)
+	}
+
+	socket := filepath.Join(os.TempDir(), fmt.Sprintf("saturncli-complete-%d.sock", time.Now().UnixNano()))
+	go server.NewServer(&utils.DefaultLogger{}, socket, server.WithRegistry(registry)).Serve()
+	time.Sleep(300 * time.Millisecond)
+
+	c := NewCmd(&utils.DefaultLogger{}, socket)
+	go c.RunWithArgs([]string{"-name", "hello_stoppable"})
+	select {
+	case <-started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for stoppable job")
+	}
+	defer NewClient(&utils.DefaultLogger{}, socket).Run(&Task{Name: "hello_stoppable", Stop: true})
+
+	ctx := context.Background()
+	cases := []struct {
+		words []string
+		want  []string
+	}{
+		{[]string{""}, []string{"run", "stop", "list", "events", "ps", "pause", "resume", "disable", "enable", "queue", "completion"}},
+		{[]string{"disable", "hello_"}, []string{"hello_stoppable"}},
+		{[]string{"pause", "--"}, []string{"--name", "--signature"}},
+		{[]string{"events", "--follow", "--name", "hello_"}, []string{"hello_stoppable"}},
+		{[]string{"ev"}, []string{"events"}},
+		{[]string{"completion", "z"}, []string{"zsh"}},
+		{[]string{"--na"}, []string{"--name"}},
+		{[]string{"--name", "hel"}, []string{"hello", "hello_stoppable"}},
+		{[]string{"--name=hello_"}, []string{"--name=hello_stoppable"}},
+		{[]string{"--name", "hello", "--param", ""}, []string{"env=", "id="}},
+		{[]string{"--name", "hello", "--param", "env="}, []string{"env=dev", "env=prod"}},
+		{[]string{"--name", "hello", "--param", "env=p"}, []string{"env=prod"}},
+		{[]string{"--name", "hello", "--args", ""}, nil},
+	}
+	for _, tc := range cases {
+		got := c.completionCandidates(ctx, tc.words)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("complete %q: got %q, want %q", tc.words, got, tc.want)
+		}
+	}
+
+	signatures := c.completionCandidates(ctx, []string{"--name", "hello_stoppable", "--stop", "--signature", ""})
+	if len(signatures) != 1 || signatures[0] == "" {
+		t.Fatalf("expected the running signature, got %q", signatures)
+	}
+}
@@ -0,0 +1,166 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+)
+
+var (
+	// ErrInvalidTask reports a task that cannot be sent, such as a nil task or an empty name.
+	ErrInvalidTask = errors.New("saturn: invalid task")
+	// ErrInterrupted reports a run cut short by context cancellation or a stop request.
+	ErrInterrupted = errors.New("saturn: run interrupted")
+	// ErrJobFailed reports a run the server did not complete successfully.
+	// Every *HandlerError matches it.
+	ErrJobFailed = errors.New("saturn: job failed")
+	// ErrJobNotFound reports a job name the server does not know.
+	ErrJobNotFound = errors.New("saturn: job not found")
+	// ErrServerUnavailable reports a server that could not be reached or answered with an error.
+	ErrServerUnavailable = errors.New("saturn: server unavailable")
+	// ErrUnauthorized reports a request the server refused for the caller.
+	ErrUnauthorized = errors.New("saturn: unauthorized")
+	// ErrJobDisabled reports a job that was disabled and rejects runs.
+	ErrJobDisabled = errors.New("saturn: job disabled")
+	// ErrLocked reports a run the server skipped because another run, possibly
+	// on another replica, held the job's lock.
+	ErrLocked = errors.New("saturn: job skipped, lock held elsewhere")
+	// ErrQueueFull reports a run the server rejected because the job's queue
+	// had no room left.
+	ErrQueueFull = errors.New("saturn: queue full")
+	// ErrRateLimited reports a run refused by a rate limit of the server. Every
+	// *RateLimitError matches it.
+	ErrRateLimited = errors.New("saturn: rate limited")
+	// ErrStopUnresponsive reports a stop whose runs did not exit within the
+	// time the stop waited for them.
+	ErrStopUnresponsive = errors.New("saturn: run did not stop")
+	// ErrNotStoppable reports a stop of a job whose handler cannot be told to
+	// stop, so its runs go on until they return.
+	ErrNotStoppable = errors.New("saturn: job not stoppable")
+	// ErrTimeout reports a request that did not complete in time.
+	ErrTimeout = errors.New("saturn: timeout")
+)
+
+// HandlerError reports a job the server ran whose handler did not succeed.
+type HandlerError struct {
+	Job       string
+	Signature string
+	// Status is the status the server replied with, usually base.FAILURE.
+	Status string
+	// Message is the explanation given by the server, if any.
+	Message string
+}
+
+func (e *HandlerError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("saturn: job %s (signature %s) finished with status %q", e.Job, e.Signature, e.Status)
+	}
+	return fmt.Sprintf("saturn: job %s (signature %s) finished with status %q: %s", e.Job, e.Signature, e.Status, e.Message)
+}
+
+// Is makes errors.Is(err, ErrJobFailed) hold for every handler error.
+func (e *HandlerError) Is(target error) bool {
+	return target == ErrJobFailed
+}
+
+// RateLimitError reports a run refused by a rate limit, with how long to
+// wait before trying again.
+type RateLimitError struct {
+	Job        string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("saturn: job %s rate limited, retry after %s", e.Job, e.RetryAfter)
+}
+
+// Is makes errors.Is(err, ErrRateLimited) hold for every rate limit error.
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// RunError reports a run whose reply never arrived, for example after a
+// timeout or a reset connection, so the server may still be running it.
+// Retrying with Signature as Task.Signature replays that run instead of
+// starting another one.
+type RunError struct {
+	Job       string
+	Signature string
+	Err       error
+}
+
+func (e *RunError) Error() string {
+	return fmt.Sprintf("%v (job %s, signature %s)", e.Err, e.Job, e.Signature)
+}
+
+func (e *RunError) Unwrap() error {
+	return e.Err
+}
+
+// classifiedError tags an underlying error with one of the sentinel errors
+// while keeping it reachable through errors.As.
+type classifiedError struct {
+	kind error
+	err  error
+}
+
+func (e *classifiedError) Error() string {
+	return e.kind.Error() + ": " + e.err.Error()
+}
+
+func (e *classifiedError) Is(target error) bool {
+	return target == e.kind
+}
+
+func (e *classifiedError) Unwrap() error {
+	return e.err
+}
+
+func classifyTransportError(err error) error {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return &classifiedError{kind: ErrTimeout, err: err}
+	}
+	return &classifiedError{kind: ErrServerUnavailable, err: err}
+}
+
+// replyError maps a server reply to nil or one of the package errors.
+func replyError(job string, code int, reply base.Response) error {
+	switch {
+	case reply.Status == base.QUEUE_FULL:
+		return &classifiedError{kind: ErrQueueFull, err: errors.New(reply.Message)}
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return &classifiedError{kind: ErrUnauthorized, err: fmt.Errorf("server replied %d %s", code, reply.Message)}
+	case code == http.StatusNotFound || reply.Status == base.NOT_EXIST:
+		return &classifiedError{kind: ErrJobNotFound, err: fmt.Errorf("job %q", job)}
+	case code == http.StatusBadGateway || code == http.StatusServiceUnavailable:
+		return &classifiedError{kind: ErrServerUnavailable, err: fmt.Errorf("server replied %d %s", code, reply.Message)}
+	case code == http.StatusGatewayTimeout:
+		return &classifiedError{kind: ErrTimeout, err: fmt.Errorf("server replied %d %s", code, reply.Message)}
+	}
+	if reply.State == base.RunUnresponsive {
+		return &classifiedError{kind: ErrStopUnresponsive, err: errors.New(reply.Message)}
+	}
+	switch reply.Status {
+	case base.SUCCESS:
+		return nil
+	case base.INTERRUPT, base.ABANDONED:
+		return ErrInterrupted
+	case base.TIMEOUT:
+		return &classifiedError{kind: ErrTimeout, err: errors.New(reply.Message)}
+	case base.DISABLED:
+		return &classifiedError{kind: ErrJobDisabled, err: errors.New(reply.Message)}
+	case base.RATE_LIMITED:
+		return &RateLimitError{Job: job, RetryAfter: time.Duration(reply.RetryAfter * float64(time.Second))}
+	case base.LOCKED:
+		return &classifiedError{kind: ErrLocked, err: errors.New(reply.Message)}
+	case base.NOT_STOPPABLE:
+		return &classifiedError{kind: ErrNotStoppable, err: errors.New(reply.Message)}
+	default:
+		return &HandlerError{Job: job, Signature: reply.Signature, Status: reply.Status, Message: reply.Message}
+	}
+}
@@ -0,0 +1,56 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+	"github.com/Kingson4Wu/saturncli/client"
+	"github.com/Kingson4Wu/saturncli/server"
+	"github.com/Kingson4Wu/saturncli/utils"
+)
+
+func TestRunContextTypedErrors(t *testing.T) {
+	registry := server.NewRegistry()
+	if err := registry.AddJob("fail", func(m map[string]string, signature string) bool {
+		return false
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+
+	socket := tempSocketPath(t, "typed-errors")
+	go server.NewServer(&utils.DefaultLogger{}, socket, server.WithRegistry(registry)).Serve()
+	time.Sleep(300 * time.Millisecond)
+
+	cli := client.NewClient(&utils.DefaultLogger{}, socket)
+
+	_, err := cli.RunContext(context.Background(), &client.Task{Name: "fail"})
+	var handlerErr *client.HandlerError
+	if !errors.As(err, &handlerErr) {
+		t.Fatalf("expected *HandlerError, got %v", err)
+	}
+	if handlerErr.Job != "fail" || handlerErr.Status != base.FAILURE || handlerErr.Message == "" || handlerErr.Signature == "" {
+		t.Fatalf("unexpected handler error: %+v", handlerErr)
+	}
+
+	if _, err := cli.RunContext(context.Background(), &client.Task{Name: "missing"}); !errors.Is(err, client.ErrJobNotFound) {
+		t.Fatalf("expected ErrJobNotFound, got %v", err)
+	}
+	if status := cli.Run(&client.Task{Name: "missing"}); status != base.NOT_EXIST {
+		t.Fatalf("expected legacy status %q, got %q", base.NOT_EXIST, status)
+	}
+
+	unreachable := client.NewClient(&utils.DefaultLogger{}, tempSocketPath(t, "unreachable"))
+	if _, err := unreachable.RunContext(context.Background(), &client.Task{Name: "fail"}); !errors.Is(err, client.ErrServerUnavailable) {
+		t.Fatalf("expected ErrServerUnavailable, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+	defer cancel()
+	time.Sleep(time.Millisecond)
+	if _, err := cli.RunContext(ctx, &client.Task{Name: "fail"}); !errors.Is(err, client.ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected ErrTimeout wrapping the deadline, got %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+)
+
+const eventsCommand = "events"
+
+// StreamEvents reads the server's event stream and calls fn for every event,
+// oldest first. Only events of job are delivered when job is not empty. With
+// follow set the stream stays open until ctx is done, otherwise it returns
+// once the recent backlog has been delivered. The stream is bounded only by
+// ctx, not by the per-run timeout.
+func (c *cli) StreamEvents(ctx context.Context, job string, follow bool, fn func(base.Event)) error {
+	query := url.Values{}
+	if job != "" {
+		query.Set("job", job)
+	}
+	if follow {
+		query.Set("follow", "true")
+	}
+	target := adminURL(base.EventsPath)
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	response, err := c.untimedHTTPClient().Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return classifyTransportError(err)
+	}
+	defer func() {
+		if err := response.Body.Close(); err != nil {
+			c.logger.Warnf("saturn client failed to close event stream: %v", err)
+		}
+	}()
+	if response.StatusCode != http.StatusOK {
+		bodyData, _ := io.ReadAll(response.Body)
+		return replyError("", response.StatusCode, decodeReply(response, bodyData))
+	}
+
+	err = readEventStream(response.Body, fn)
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err != nil {
+		return classifyTransportError(err)
+	}
+	return nil
+}
+
+// readEventStream decodes the data lines of a server-sent event stream.
+// Comments such as keep-alive pings and the event name lines are skipped.
+func readEventStream(r io.Reader, fn func(base.Event)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue
+		}
+		var event base.Event
+		if err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &event); err != nil {
+			return fmt.Errorf("decode event: %w", err)
+		}
+		fn(event)
+	}
+	return scanner.Err()
+}
+
+type eventsOptions struct {
+	name   string
+	follow bool
+}
+
+func newEventsFlagSet(opts *eventsOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet("saturn-cli events", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&opts.name, "name", "", "Only show events of this job")
+	fs.BoolVar(&opts.follow, "follow", false, "Keep streaming new events until interrupted")
+	return fs
+}
+
+func (c *cmd) runEvents(arguments []string) int {
+	opts := &eventsOptions{}
+	if ok, code := c.parseSubcommand(eventsCommand, "[--name job] [--follow]", newEventsFlagSet(opts), arguments); !ok {
+		return code
+	}
+
+	ctx, stopSignals := signalContext(context.Background(), c.logger)
+	defer stopSignals()
+	err := c.newClient().StreamEvents(ctx, opts.name, opts.follow, func(event base.Event) {
+		writeEvent(os.Stdout, event)
+	})
+	if err != nil {
+		c.logger.Errorf("saturn client events failure: %+v", err)
+		fmt.Fprintln(os.Stderr, "Execution Failure")
+		return 1
+	}
+	return 0
+}
+
+// writeEvent prints one event per line: time, type, job, signature, then the
+// progress and message when present.
+func writeEvent(w io.Writer, event base.Event) {
+	line := fmt.Sprintf("%s %-14s %s %s", event.Time.Format(time.RFC3339), event.Type, event.Job, event.Signature)
+	if event.Type == base.EventProgress && event.Percent > 0 {
+		line += fmt.Sprintf(" %.0f%%", event.Percent)
+	}
+	if event.Message != "" {
+		line += " " + event.Message
+	}
+	fmt.Fprintln(w, line)
+}
@@ -0,0 +1,62 @@
+package client_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+	"github.com/Kingson4Wu/saturncli/client"
+	"github.com/Kingson4Wu/saturncli/server"
+	"github.com/Kingson4Wu/saturncli/utils"
+)
+
+func TestStreamEvents(t *testing.T) {
+	registry := server.NewRegistry()
+	if err := registry.AddJob("hello", func(m map[string]string, signature string) bool {
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+
+	socket := tempSocketPath(t, "events")
+	go server.NewServer(&utils.DefaultLogger{}, socket, server.WithRegistry(registry)).Serve()
+	time.Sleep(300 * time.Millisecond)
+
+	cli := client.NewClient(&utils.DefaultLogger{}, socket)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan base.Event, 16)
+	streamDone := make(chan error, 1)
+	go func() {
+		streamDone <- cli.StreamEvents(ctx, "hello", true, func(event base.Event) {
+			events <- event
+		})
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	result, err := cli.RunContext(context.Background(), &client.Task{Name: "hello"})
+	if err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	for _, want := range []string{base.EventStarted, base.EventSucceeded} {
+		select {
+		case event := <-events:
+			if event.Type != want || event.Signature != result.Signature {
+				t.Fatalf("expected %s for %s, got %+v", want, result.Signature, event)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s event not streamed", want)
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-streamDone:
+		if err != nil {
+			t.Fatalf("cancelled stream should end cleanly, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("stream did not end after cancellation")
+	}
+}
@@ -0,0 +1,98 @@
+package client
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/Kingson4Wu/saturncli/base"
+)
+
+const (
+	disableCommand = "disable"
+	enableCommand  = "enable"
+)
+
+// DisableJob makes job reject new runs until EnableJob is called. Runs are
+// then answered with an error matching ErrJobDisabled that carries reason.
+func (c *cli) DisableJob(ctx context.Context, job, reason string) error {
+	return c.toggleJob(ctx, base.DisablePath, job, url.Values{"reason": {reason}})
+}
+
+// EnableJob lets a disabled job run again.
+func (c *cli) EnableJob(ctx context.Context, job string) error {
+	return c.toggleJob(ctx, base.EnablePath, job, url.Values{})
+}
+
+func (c *cli) toggleJob(ctx context.Context, path, job string, query url.Values) error {
+	if strings.TrimSpace(job) == "" {
+		return fmt.Errorf("%w: job name is empty", ErrInvalidTask)
+	}
+	query.Set("job", job)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, adminURL(path)+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", base.JSONContentType)
+	response, bodyData, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	c.logger.Infof("saturn client receive result from server, task: %s, resp: %s", job, string(bodyData))
+	return replyError(job, response.StatusCode, decodeReply(response, bodyData))
+}
+
+type toggleOptions struct {
+	name   string
+	reason string
+}
+
+func newToggleFlagSet(command string, opts *toggleOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet("saturn-cli "+command, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&opts.name, "name", "", "Input Job Name")
+	if command == disableCommand {
+		fs.StringVar(&opts.reason, "reason", "", "Why the job is disabled, shown to callers")
+	}
+	return fs
+}
+
+// runToggle handles "disable NAME [--reason text]" and "enable NAME"; the job
+// may also be given with --name.
+func (c *cmd) runToggle(command string, arguments []string) int {
+	opts := &toggleOptions{}
+	positional := ""
+	if len(arguments) > 0 && !strings.HasPrefix(arguments[0], "-") {
+		positional, arguments = arguments[0], arguments[1:]
+	}
+	usage := "NAME"
+	if command == disableCommand {
+		usage += " [--reason text]"
+	}
+	if ok, code := c.parseSubcommand(command, usage, newToggleFlagSet(command, opts), arguments); !ok {
+		return code
+	}
+	if opts.name == "" {
+		opts.name = positional
+	}
+
+	cli := c.newClient()
+	var err error
+	if command == disableCommand {
+		err = cli.DisableJob(context.Background(), opts.name, opts.reason)
+	} else {
+		err = cli.EnableJob(context.Background(), opts.name)
+	}
+	if err != nil {
+		c.logger.Errorf("saturn client %s failure: %+v", command, err)
+		fmt.Fprintln(os.Stderr, "Execution Failure")
+		return 1
+	}
+	fmt.Fprintln(os.Stderr, "Execution Success")
+	return 0
+}
@@ -0,0 +1,46 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+	"github.com/Kingson4Wu/saturncli/client"
+	"github.com/Kingson4Wu/saturncli/server"
+	"github.com/Kingson4Wu/saturncli/utils"
+)
+
+func TestDisableJob(t *testing.T) {
+	registry := server.NewRegistry()
+	if err := registry.AddJob("purge", func(m map[string]string, signature string) bool {
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+
+	socket := tempSocketPath(t, "disable")
+	go server.NewServer(&utils.DefaultLogger{}, socket, server.WithRegistry(registry)).Serve()
+	time.Sleep(300 * time.Millisecond)
+
+	cmd := client.NewCmd(quietLogger{}, socket)
+	if code := cmd.Execute([]string{"disable", "purge", "--reason", "incident 42"}); code != 0 {
+		t.Fatalf("disable exited with %d", code)
+	}
+	cli := client.NewClient(&utils.DefaultLogger{}, socket)
+	result, err := cli.RunContext(context.Background(), &client.Task{Name: "purge"})
+	if !errors.Is(err, client.ErrJobDisabled) || result.Status != base.DISABLED || !strings.Contains(result.Message, "incident 42") {
+		t.Fatalf("expected ErrJobDisabled with the reason, got %+v, %v", result, err)
+	}
+	if code := cmd.Execute([]string{"purge"}); code != 1 {
+		t.Fatalf("running a disabled job should exit 1, got %d", code)
+	}
+	if code := cmd.Execute([]string{"enable", "purge"}); code != 0 {
+		t.Fatalf("enable exited with %d", code)
+	}
+	if _, err := cli.RunContext(context.Background(), &client.Task{Name: "purge"}); err != nil {
+		t.Fatalf("enabled job should run, got %v", err)
+	}
+}
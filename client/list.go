@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Kingson4Wu/saturncli/base"
+)
+
+const listCommand = "list"
+
+// ListOption narrows the jobs returned by ListJobs.
+type ListOption func(url.Values)
+
+// WithTag lists only jobs registered with tag.
+func WithTag(tag string) ListOption {
+	return func(query url.Values) {
+		if tag != "" {
+			query.Set("tag", tag)
+		}
+	}
+}
+
+// WithPattern lists only jobs whose name matches pattern, where '*' matches
+// any run of characters: "billing.*" lists every job below billing.
+func WithPattern(pattern string) ListOption {
+	return func(query url.Values) {
+		if pattern != "" {
+			query.Set("match", pattern)
+		}
+	}
+}
+
+// WithHidden includes jobs registered as hidden.
+func WithHidden() ListOption {
+	return func(query url.Values) {
+		query.Set("hidden", "true")
+	}
+}
+
+type listOptions struct {
+	tag    string
+	hidden bool
+}
+
+func newListFlagSet(opts *listOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet("saturn-cli list", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&opts.tag, "tag", "", "Only list jobs with this tag")
+	fs.BoolVar(&opts.hidden, "all", false, "Include hidden jobs")
+	return fs
+}
+
+// runList handles "list [PATTERN] [--tag tag] [--all]".
+func (c *cmd) runList(arguments []string) int {
+	opts := &listOptions{}
+	pattern := ""
+	if len(arguments) > 0 && !strings.HasPrefix(arguments[0], "-") {
+		pattern, arguments = arguments[0], arguments[1:]
+	}
+	if ok, code := c.parseSubcommand(listCommand, "[PATTERN] [--tag tag] [--all]", newListFlagSet(opts), arguments); !ok {
+		return code
+	}
+	listOpts := []ListOption{WithPattern(pattern), WithTag(opts.tag)}
+	if opts.hidden {
+		listOpts = append(listOpts, WithHidden())
+	}
+	jobs, err := c.newClient().ListJobs(context.Background(), listOpts...)
+	if err != nil {
+		c.logger.Errorf("saturn client list failure: %+v", err)
+		fmt.Fprintln(os.Stderr, "Execution Failure")
+		return 1
+	}
+	writeJobs(os.Stdout, jobs)
+	return 0
+}
+
+func writeJobs(w io.Writer, jobs []base.JobInfo) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTAGS\tOWNER\tDESCRIPTION")
+	for _, job := range jobs {
+		description := job.Description
+		if job.Deprecated != "" {
+			description = strings.TrimSpace("[deprecated: " + job.Deprecated + "] " + description)
+		}
+		if job.Disabled != "" {
+			description = strings.TrimSpace("[disabled: " + job.Disabled + "] " + description)
+		}
+		name := job.Name
+		if job.Hidden {
+			name += " (hidden)"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", name, strings.Join(job.Tags, ","), job.Owner, description)
+	}
+	_ = tw.Flush()
+}
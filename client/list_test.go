@@ -0,0 +1,71 @@
+package client_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/client"
+	"github.com/Kingson4Wu/saturncli/server"
+	"github.com/Kingson4Wu/saturncli/utils"
+)
+
+func TestListJobsFilters(t *testing.T) {
+	registry := server.NewRegistry()
+	handler := func(m map[string]string, signature string) bool { return true }
+	if err := registry.AddJob("reindex", handler,
+		server.WithDescription("Rebuild the search index"),
+		server.WithTags("search", "maintenance"),
+		server.WithOwner("search-team")); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	if err := registry.AddJob("reindex_v1", handler,
+		server.WithTags("search"),
+		server.WithDeprecated("use reindex")); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	if err := registry.AddJob("debug_dump", handler, server.WithTags("search"), server.WithHidden()); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	if err := registry.AddJob("vacuum", handler, server.WithTags("maintenance")); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+
+	socket := tempSocketPath(t, "list")
+	go server.NewServer(&utils.DefaultLogger{}, socket, server.WithRegistry(registry)).Serve()
+	time.Sleep(300 * time.Millisecond)
+
+	cli := client.NewClient(&utils.DefaultLogger{}, socket)
+	names := func(opts ...client.ListOption) []string {
+		jobs, err := cli.ListJobs(context.Background(), opts...)
+		if err != nil {
+			t.Fatalf("list failed: %v", err)
+		}
+		var out []string
+		for _, job := range jobs {
+			out = append(out, job.Name)
+		}
+		return out
+	}
+	if got := names(); !reflect.DeepEqual(got, []string{"reindex", "reindex_v1", "vacuum"}) {
+		t.Fatalf("hidden jobs should not be listed by default, got %v", got)
+	}
+	if got := names(client.WithTag("search")); !reflect.DeepEqual(got, []string{"reindex", "reindex_v1"}) {
+		t.Fatalf("unexpected jobs tagged search: %v", got)
+	}
+	if got := names(client.WithTag("search"), client.WithHidden()); !reflect.DeepEqual(got, []string{"debug_dump", "reindex", "reindex_v1"}) {
+		t.Fatalf("unexpected jobs with hidden: %v", got)
+	}
+
+	jobs, err := cli.ListJobs(context.Background(), client.WithTag("maintenance"))
+	if err != nil || len(jobs) != 2 {
+		t.Fatalf("unexpected maintenance jobs: %+v, %v", jobs, err)
+	}
+	if job := jobs[0]; job.Description != "Rebuild the search index" || job.Owner != "search-team" || !reflect.DeepEqual(job.Tags, []string{"search", "maintenance"}) {
+		t.Fatalf("registration options not surfaced: %+v", job)
+	}
+	if code := client.NewCmd(quietLogger{}, socket).Execute([]string{"list", "--tag", "search"}); code != 0 {
+		t.Fatalf("list exited with %d", code)
+	}
+}
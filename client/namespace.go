@@ -0,0 +1,18 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// StopNamespace asks every run in flight of the jobs below namespace, such
+// as "billing", to stop. It returns an error matching ErrJobFailed when no
+// run was in flight.
+func (c *cli) StopNamespace(ctx context.Context, namespace string) error {
+	if strings.TrimSpace(namespace) == "" {
+		return fmt.Errorf("%w: namespace is empty", ErrInvalidTask)
+	}
+	_, err := c.StopMatching(ctx, StopFilter{Namespace: namespace}, "")
+	return err
+}
@@ -0,0 +1,60 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/client"
+	"github.com/Kingson4Wu/saturncli/server"
+	"github.com/Kingson4Wu/saturncli/utils"
+)
+
+func TestNamespaces(t *testing.T) {
+	registry := server.NewRegistry()
+	billing := registry.Group("billing")
+	ok := func(m map[string]string, signature string) bool { return true }
+	if err := billing.AddJob("reindex", ok); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	if err := billing.Group("invoices").AddJob("send", ok); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	if err := registry.AddJob("cleanup", ok); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	billing.Group("invoices").SetACL(server.AllowUIDs(os.Getuid() + 1))
+
+	socket := tempSocketPath(t, "namespaces")
+	go server.NewServer(&utils.DefaultLogger{}, socket, server.WithRegistry(registry)).Serve()
+	time.Sleep(300 * time.Millisecond)
+
+	cli := client.NewClient(&utils.DefaultLogger{}, socket)
+	jobs, err := cli.ListJobs(context.Background(), client.WithPattern("billing.*"))
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(jobs) != 2 || jobs[0].Name != "billing.invoices.send" || jobs[1].Name != "billing.reindex" {
+		t.Fatalf("unexpected jobs for billing.*: %+v", jobs)
+	}
+	if _, err := cli.RunContext(context.Background(), &client.Task{Name: "billing.reindex"}); err != nil {
+		t.Fatalf("namespaced job should run: %v", err)
+	}
+	if _, err := cli.RunContext(context.Background(), &client.Task{Name: "billing.invoices.send"}); !errors.Is(err, client.ErrUnauthorized) {
+		t.Fatalf("expected ErrUnauthorized from the namespace ACL, got %v", err)
+	}
+	if err := cli.StopNamespace(context.Background(), "billing"); !errors.Is(err, client.ErrJobFailed) {
+		t.Fatalf("stopping an idle namespace should report that nothing matched, got %v", err)
+	}
+
+	if runtime.GOOS != "linux" {
+		return
+	}
+	billing.Group("invoices").SetACL(server.AllowUIDs(os.Getuid()))
+	if _, err := cli.RunContext(context.Background(), &client.Task{Name: "billing.invoices.send"}); err != nil {
+		t.Fatalf("the ACL should admit the current user: %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+)
+
+const (
+	queueCommand = "queue"
+
+	queuePollInterval = 500 * time.Millisecond
+)
+
+// WithQueuePosition calls fn while a run waits in a server-side queue, each
+// time its position changes. Positions are polled, so short waits may go
+// unreported; runs of jobs without a queue are not polled for.
+func WithQueuePosition(fn func(base.QueuedRun)) ClientOption {
+	return func(c *cli) {
+		c.onQueued = fn
+	}
+}
+
+// Queues asks the server for its queue classes: workers, runs executing,
+// depth, capacity, counters and the runs waiting in order.
+func (c *cli) Queues(ctx context.Context) ([]base.QueueInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, adminURL(base.QueuePath), nil)
+	if err != nil {
+		return nil, err
+	}
+	response, bodyData, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, replyError("", response.StatusCode, decodeReply(response, bodyData))
+	}
+	var queues []base.QueueInfo
+	if err := json.Unmarshal(bodyData, &queues); err != nil {
+		return nil, fmt.Errorf("decode queues: %w", err)
+	}
+	return queues, nil
+}
+
+// watchQueue reports the queue position of the run signature of job to the
+// WithQueuePosition callback until the returned function is called. Polling
+// starts after one interval, so runs done by then cost no request, and only
+// when the job has a queue; it ends once the run is not waiting.
+func (c *cli) watchQueue(ctx context.Context, job, signature string) (stop func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(queuePollInterval)
+		defer ticker.Stop()
+		checked, last := false, 0
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if !checked {
+				queued, err := c.jobQueued(ctx, job)
+				if err != nil {
+					continue
+				}
+				if !queued {
+					return
+				}
+				checked = true
+			}
+			queues, err := c.Queues(ctx)
+			if err != nil {
+				continue
+			}
+			waiting := false
+			for _, queue := range queues {
+				for _, run := range queue.Waiting {
+					if run.Signature != signature {
+						continue
+					}
+					if waiting = true; run.Position != last {
+						last = run.Position
+						c.onQueued(run)
+					}
+				}
+			}
+			if !waiting {
+				return
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// jobQueued reports whether runs of job wait in a server-side queue.
+func (c *cli) jobQueued(ctx context.Context, job string) (bool, error) {
+	jobs, err := c.ListJobs(ctx, WithPattern(job), WithHidden())
+	if err != nil {
+		return false, err
+	}
+	for _, info := range jobs {
+		if info.Name == job {
+			return info.Queue != "", nil
+		}
+	}
+	return false, nil
+}
+
+func (c *cmd) runQueue(arguments []string) int {
+	if ok, code := c.parseSubcommand(queueCommand, "", newQueueFlagSet(), arguments); !ok {
+		return code
+	}
+	queues, err := c.newClient().Queues(context.Background())
+	if err != nil {
+		c.logger.Errorf("saturn client queue failure: %+v", err)
+		fmt.Fprintln(os.Stderr, "Execution Failure")
+		return 1
+	}
+	writeQueues(os.Stdout, queues)
+	return 0
+}
+
+func newQueueFlagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet("saturn-cli queue", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+func writeQueues(w io.Writer, queues []base.QueueInfo) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "CLASS\tWORKERS\tRUNNING\tDEPTH\tCAPACITY\tPROCESSED\tREJECTED")
+	var waiting []string
+	for _, queue := range queues {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%d\n", queue.Class, queue.Workers, queue.Running, queue.Depth, queue.Capacity, queue.Processed, queue.Rejected)
+		for _, run := range queue.Waiting {
+			waiting = append(waiting, fmt.Sprintf("%d\t%s\t%s\t%s\t%d", run.Position, queue.Class, run.Job, run.Signature, run.Priority))
+		}
+	}
+	if len(waiting) > 0 {
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "POSITION\tCLASS\tJOB\tSIGNATURE\tPRIORITY")
+		fmt.Fprintln(tw, strings.Join(waiting, "\n"))
+	}
+	_ = tw.Flush()
+}
@@ -0,0 +1,118 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+	"github.com/Kingson4Wu/saturncli/client"
+	"github.com/Kingson4Wu/saturncli/server"
+	"github.com/Kingson4Wu/saturncli/utils"
+)
+
+func TestQueuedRuns(t *testing.T) {
+	registry := server.NewRegistry()
+	started, release := make(chan struct{}, 2), make(chan struct{})
+	if err := registry.AddJob("report", func(m map[string]string, signature string) bool {
+		started <- struct{}{}
+		<-release
+		return true
+	}, server.WithQueue("reports")); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+
+	socket := tempSocketPath(t, "queue")
+	go server.NewServer(&utils.DefaultLogger{}, socket, server.WithRegistry(registry), server.WithQueueClass("reports", 1, 1)).Serve()
+	time.Sleep(300 * time.Millisecond)
+
+	cli := client.NewClient(&utils.DefaultLogger{}, socket)
+	first := make(chan error, 1)
+	go func() {
+		_, err := cli.RunContext(context.Background(), &client.Task{Name: "report"})
+		first <- err
+	}()
+	<-started
+
+	positions := make(chan base.QueuedRun, 1)
+	watching := client.NewClient(&utils.DefaultLogger{}, socket, client.WithQueuePosition(func(run base.QueuedRun) {
+		select {
+		case positions <- run:
+		default:
+		}
+	}))
+	second := make(chan error, 1)
+	go func() {
+		_, err := watching.RunContext(context.Background(), &client.Task{Name: "report", Priority: 3})
+		second <- err
+	}()
+	select {
+	case run := <-positions:
+		if run.Position != 1 || run.Priority != 3 || run.Job != "report" {
+			t.Fatalf("unexpected queue position: %+v", run)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("queue position was not reported")
+	}
+
+	queues, err := cli.Queues(context.Background())
+	if err != nil || len(queues) != 1 || queues[0].Depth != 1 || queues[0].Running != 1 {
+		t.Fatalf("unexpected queues: %+v, %v", queues, err)
+	}
+	if _, err := cli.RunContext(context.Background(), &client.Task{Name: "report"}); !errors.Is(err, client.ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+
+	close(release)
+	for _, done := range []chan error{first, second} {
+		if err := <-done; err != nil {
+			t.Fatalf("queued run failed: %v", err)
+		}
+	}
+}
+
+func TestQueuePositionPollsOnlyWaitingRuns(t *testing.T) {
+	registry := server.NewRegistry()
+	slow := func(m map[string]string, signature string) bool {
+		time.Sleep(1200 * time.Millisecond)
+		return true
+	}
+	if err := registry.AddJob("plain", slow); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	if err := registry.AddJob("report", slow, server.WithQueue("reports")); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	srv := server.NewServer(&utils.DefaultLogger{}, "", server.WithRegistry(registry), server.WithQueueClass("reports", 1, 1))
+	var polls atomic.Int32
+	socket := tempSocketPath(t, "queue-polls")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+	go http.Serve(listener, http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == base.QueuePath {
+			polls.Add(1)
+		}
+		srv.ServeHTTP(rw, r)
+	}))
+
+	cli := client.NewClient(&utils.DefaultLogger{}, socket, client.WithQueuePosition(func(base.QueuedRun) {}))
+	if _, err := cli.RunContext(context.Background(), &client.Task{Name: "plain"}); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if n := polls.Load(); n != 0 {
+		t.Fatalf("a job without a queue should not be polled for, got %d polls", n)
+	}
+	if _, err := cli.RunContext(context.Background(), &client.Task{Name: "report"}); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+	if n := polls.Load(); n != 1 {
+		t.Fatalf("polling should end once the run is not waiting, got %d polls", n)
+	}
+}
@@ -0,0 +1,24 @@
+package client
+
+import "time"
+
+// defaultCLIRateLimitWait is how long the command line waits out rate limits
+// unless --rate-limit-wait says otherwise.
+const defaultCLIRateLimitWait = time.Minute
+
+// WithCallerToken identifies the client to the server by token, so
+// per-caller rate limits count its runs apart from other processes of the
+// same user. The token is an identifier, not a credential.
+func WithCallerToken(token string) ClientOption {
+	return func(c *cli) {
+		c.callerToken = token
+	}
+}
+
+// WithRateLimitWait makes RunContext honour rate limits by waiting the time
+// the server asks for and retrying, for at most max in total per run.
+func WithRateLimitWait(max time.Duration) ClientOption {
+	return func(c *cli) {
+		c.rateLimitWait = max
+	}
+}
@@ -0,0 +1,46 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+	"github.com/Kingson4Wu/saturncli/client"
+	"github.com/Kingson4Wu/saturncli/server"
+	"github.com/Kingson4Wu/saturncli/utils"
+)
+
+func TestRunContextRateLimited(t *testing.T) {
+	registry := server.NewRegistry()
+	if err := registry.AddJob("report", func(m map[string]string, signature string) bool {
+		return true
+	}, server.WithCallerRateLimit(300*time.Millisecond, 1)); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+
+	socket := tempSocketPath(t, "rate-limit")
+	go server.NewServer(&utils.DefaultLogger{}, socket, server.WithRegistry(registry)).Serve()
+	time.Sleep(300 * time.Millisecond)
+
+	cli := client.NewClient(&utils.DefaultLogger{}, socket, client.WithCallerToken("nightly"))
+	if _, err := cli.RunContext(context.Background(), &client.Task{Name: "report"}); err != nil {
+		t.Fatalf("first run failed: %v", err)
+	}
+	result, err := cli.RunContext(context.Background(), &client.Task{Name: "report"})
+	var limited *client.RateLimitError
+	if !errors.As(err, &limited) || !errors.Is(err, client.ErrRateLimited) || limited.RetryAfter <= 0 || result.Status != base.RATE_LIMITED {
+		t.Fatalf("expected a rate limit error with a retry delay, got %+v, %v", result, err)
+	}
+
+	other := client.NewClient(&utils.DefaultLogger{}, socket, client.WithCallerToken("adhoc"))
+	if _, err := other.RunContext(context.Background(), &client.Task{Name: "report"}); err != nil {
+		t.Fatalf("another caller should have its own limit: %v", err)
+	}
+
+	waiting := client.NewClient(&utils.DefaultLogger{}, socket, client.WithCallerToken("nightly"), client.WithRateLimitWait(time.Second))
+	if _, err := waiting.RunContext(context.Background(), &client.Task{Name: "report"}); err != nil {
+		t.Fatalf("waiting out the limit should succeed: %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+)
+
+const (
+	psCommand     = "ps"
+	pauseCommand  = "pause"
+	resumeCommand = "resume"
+)
+
+// ListRuns asks the server which runs are in flight, queued ones included,
+// and their state: queued, running, paused or stopping, and whether they
+// can be stopped. An empty job lists runs of every job.
+func (c *cli) ListRuns(ctx context.Context, job string) ([]base.RunInfo, error) {
+	target := adminURL(base.RunsPath)
+	if job != "" {
+		target += "?" + url.Values{"job": {job}}.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, bodyData, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, replyError(job, response.StatusCode, decodeReply(response, bodyData))
+	}
+	var runs []base.RunInfo
+	if err := json.Unmarshal(bodyData, &runs); err != nil {
+		return nil, fmt.Errorf("decode run list: %w", err)
+	}
+	return runs, nil
+}
+
+// Pause asks the run of job identified by signature to yield until resumed.
+// Only request-style jobs and workflows can be paused; the handler pauses at
+// its next JobRequest.WaitIfPaused call.
+func (c *cli) Pause(ctx context.Context, job, signature string) error {
+	return c.controlRun(ctx, base.PausePath, job, signature)
+}
+
+// Resume lets a paused run continue.
+func (c *cli) Resume(ctx context.Context, job, signature string) error {
+	return c.controlRun(ctx, base.ResumePath, job, signature)
+}
+
+func (c *cli) controlRun(ctx context.Context, path, job, signature string) error {
+	if strings.TrimSpace(job) == "" || strings.TrimSpace(signature) == "" {
+		return fmt.Errorf("%w: job name and signature are required", ErrInvalidTask)
+	}
+	target := adminURL(path) + "?" + url.Values{"job": {job}, "signature": {signature}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", base.JSONContentType)
+	response, bodyData, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	reply := decodeReply(response, bodyData)
+	c.logger.Infof("saturn client receive result from server, task: %s, signature: %s, resp: %s", job, signature, string(bodyData))
+	return replyError(job, response.StatusCode, reply)
+}
+
+type runControlOptions struct {
+	name      string
+	signature string
+}
+
+func newPsFlagSet(opts *runControlOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet("saturn-cli ps", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&opts.name, "name", "", "Only list runs of this job")
+	return fs
+}
+
+func newRunControlFlagSet(command string, opts *runControlOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet("saturn-cli "+command, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&opts.name, "name", "", "Input Job Name")
+	fs.StringVar(&opts.signature, "signature", "", "Signature of the run")
+	return fs
+}
+
+// parseSubcommand parses arguments with fs, printing usage on error.
+func (c *cmd) parseSubcommand(command, usage string, fs *flag.FlagSet, arguments []string) (ok bool, code int) {
+	err := fs.Parse(arguments)
+	if err == nil && fs.NArg() > 0 {
+		err = fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	if err == nil {
+		return true, 0
+	}
+	fmt.Fprintf(os.Stderr, "usage: %s %s %s\n", programName(), command, usage)
+	fs.SetOutput(os.Stderr)
+	fs.PrintDefaults()
+	if errors.Is(err, flag.ErrHelp) {
+		return false, 0
+	}
+	c.logger.Errorf("saturn client parse %s arguments failure: %+v", command, err)
+	return false, 1
+}
+
+func (c *cmd) runPs(arguments []string) int {
+	opts := &runControlOptions{}
+	if ok, code := c.parseSubcommand(psCommand, "[--name job]", newPsFlagSet(opts), arguments); !ok {
+		return code
+	}
+	runs, err := c.newClient().ListRuns(context.Background(), opts.name)
+	if err != nil {
+		c.logger.Errorf("saturn client ps failure: %+v", err)
+		fmt.Fprintln(os.Stderr, "Execution Failure")
+		return 1
+	}
+	writeRuns(os.Stdout, runs, time.Now())
+	return 0
+}
+
+func (c *cmd) runControl(command string, arguments []string) int {
+	opts := &runControlOptions{}
+	if ok, code := c.parseSubcommand(command, "--name job --signature signature", newRunControlFlagSet(command, opts), arguments); !ok {
+		return code
+	}
+	cli := c.newClient()
+	var err error
+	if command == pauseCommand {
+		err = cli.Pause(context.Background(), opts.name, opts.signature)
+	} else {
+		err = cli.Resume(context.Background(), opts.name, opts.signature)
+	}
+	if err != nil {
+		c.logger.Errorf("saturn client %s failure: %+v", command, err)
+		fmt.Fprintln(os.Stderr, "Execution Failure")
+		return 1
+	}
+	fmt.Fprintln(os.Stderr, "Execution Success")
+	return 0
+}
+
+func writeRuns(w io.Writer, runs []base.RunInfo, now time.Time) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "JOB\tSIGNATURE\tSTATE\tELAPSED")
+	for _, run := range runs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", run.Job, run.Signature, run.State, now.Sub(run.StartedAt).Truncate(time.Second))
+	}
+	_ = tw.Flush()
+}
@@ -0,0 +1,67 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+	"github.com/Kingson4Wu/saturncli/client"
+	"github.com/Kingson4Wu/saturncli/server"
+	"github.com/Kingson4Wu/saturncli/utils"
+)
+
+func TestPauseResumeAndListRuns(t *testing.T) {
+	registry := server.NewRegistry()
+	started, paused := make(chan struct{}), make(chan struct{})
+	if err := registry.AddRequestJob("backfill", func(req *server.JobRequest) bool {
+		close(started)
+		for !req.Paused() {
+			time.Sleep(time.Millisecond)
+		}
+		close(paused)
+		return req.WaitIfPaused()
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+
+	socket := tempSocketPath(t, "pause")
+	go server.NewServer(&utils.DefaultLogger{}, socket, server.WithRegistry(registry)).Serve()
+	time.Sleep(300 * time.Millisecond)
+
+	cli := client.NewClient(&utils.DefaultLogger{}, socket)
+	done := make(chan error, 1)
+	go func() {
+		_, err := cli.RunContext(context.Background(), &client.Task{Name: "backfill"})
+		done <- err
+	}()
+	<-started
+
+	runs, err := cli.ListRuns(context.Background(), "backfill")
+	if err != nil || len(runs) != 1 || runs[0].State != base.RunRunning {
+		t.Fatalf("expected one running run, got %+v, %v", runs, err)
+	}
+	signature := runs[0].Signature
+	if err := cli.Pause(context.Background(), "backfill", signature); err != nil {
+		t.Fatalf("pause failed: %v", err)
+	}
+	if runs, err := cli.ListRuns(context.Background(), ""); err != nil || len(runs) != 1 || runs[0].State != base.RunPaused {
+		t.Fatalf("expected the run to show as paused, got %+v, %v", runs, err)
+	}
+	if err := cli.Pause(context.Background(), "backfill", "missing"); !errors.Is(err, client.ErrJobNotFound) {
+		t.Fatalf("expected ErrJobNotFound for an unknown run, got %v", err)
+	}
+	<-paused
+	if code := client.NewCmd(quietLogger{}, socket).Execute([]string{"resume", "--name", "backfill", "--signature", signature}); code != 0 {
+		t.Fatalf("resume exited with %d", code)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("resumed run failed: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("run did not finish after resume")
+	}
+}
@@ -0,0 +1,33 @@
+package client
+
+import (
+	"context"
+
+	"github.com/Kingson4Wu/saturncli/utils"
+)
+
+// signalContext derives a context that is cancelled when the process receives
+// one of the signals watched by utils.ListenSignal. Calling the returned
+// function releases the signal handlers.
+func signalContext(parent context.Context, logger utils.Logger) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	signalChan := utils.ListenSignal()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		select {
+		case <-ctx.Done():
+		case signal := <-signalChan:
+			if signal == nil {
+				return
+			}
+			logger.Warnf("saturn client listen signal: %s, request interrupt", signal)
+			cancel()
+		}
+	}()
+	return ctx, func() {
+		cancel()
+		<-done
+		utils.StopSignal(signalChan)
+	}
+}
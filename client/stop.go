@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+)
+
+// StopFilter selects the runs StopMatching stops. A run must match every
+// field that is set, and at least one must be.
+type StopFilter struct {
+	// Job is a job name or a pattern such as "billing.*".
+	Job string
+	// Namespace matches the jobs below a namespace, such as "billing".
+	Namespace string
+	// Caller is the caller token (see WithCallerToken) or uid of the caller
+	// that started the runs.
+	Caller string
+	// OlderThan matches runs started longer ago than this.
+	OlderThan time.Duration
+	// Params matches runs started with these parameter values.
+	Params map[string]string
+}
+
+func (f StopFilter) query() url.Values {
+	query := url.Values{}
+	for key, value := range map[string]string{"job": f.Job, "namespace": f.Namespace, "caller": f.Caller} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	if f.OlderThan > 0 {
+		query.Set("older_than", f.OlderThan.String())
+	}
+	keys := make([]string, 0, len(f.Params))
+	for key := range f.Params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		query.Add("param", key+"="+f.Params[key])
+	}
+	return query
+}
+
+// StopMatching asks every run in flight that matches filter to stop, giving
+// reason to the handlers and their history records, and returns how many
+// runs were asked. It returns an error matching ErrJobFailed when no run
+// matched. Runs of jobs the caller may not use are left alone.
+func (c *cli) StopMatching(ctx context.Context, filter StopFilter, reason string) (int, error) {
+	query := filter.query()
+	if len(query) == 0 {
+		return 0, fmt.Errorf("%w: stop filter is empty", ErrInvalidTask)
+	}
+	if reason != "" {
+		query.Set("reason", reason)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, adminURL(base.StopPath)+"?"+query.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept", base.JSONContentType)
+	response, bodyData, err := c.do(req)
+	if err != nil {
+		return 0, err
+	}
+	c.logger.Infof("saturn client receive result from server, stop filter: %+v, resp: %s", filter, string(bodyData))
+	reply := decodeReply(response, bodyData)
+	return reply.Stopped, replyError(filter.Job+filter.Namespace, response.StatusCode, reply)
+}
+
+// executeStopMatching handles "stop" with a job pattern or filter flags
+// instead of a single job.
+func (c *cmd) executeStopMatching(opts *cmdOptions) int {
+	if opts.wait > 0 || opts.force {
+		fmt.Fprintln(os.Stderr, "Execution Failure: --wait and --force stop a single job, not a filter")
+		return 1
+	}
+	filter := StopFilter{Job: opts.name, Caller: opts.startedBy, OlderThan: opts.olderThan, Params: opts.params}
+	stopped, err := c.newClient(WithCallerToken(opts.callerToken)).StopMatching(context.Background(), filter, opts.reason)
+	if err != nil {
+		c.logger.Errorf("saturn client filtered stop failure: %+v", err)
+		fmt.Fprintln(os.Stderr, "Execution Failure")
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "Execution Success: %d runs asked to stop\n", stopped)
+	return 0
+}
@@ -0,0 +1,59 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+	"github.com/Kingson4Wu/saturncli/client"
+	"github.com/Kingson4Wu/saturncli/server"
+	"github.com/Kingson4Wu/saturncli/utils"
+)
+
+func TestStopMatching(t *testing.T) {
+	registry := server.NewRegistry()
+	started := make(chan struct{}, 2)
+	if err := registry.AddRequestJob("reindex", func(req *server.JobRequest) bool {
+		started <- struct{}{}
+		<-req.Quit()
+		return false
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+
+	socket := tempSocketPath(t, "stop-matching")
+	go server.NewServer(&utils.DefaultLogger{}, socket, server.WithRegistry(registry)).Serve()
+	time.Sleep(300 * time.Millisecond)
+
+	cli := client.NewClient(&utils.DefaultLogger{}, socket)
+	run := func(tenant string) <-chan *client.Result {
+		done := make(chan *client.Result, 1)
+		go func() {
+			result, _ := cli.RunContext(context.Background(), &client.Task{Name: "reindex", Signature: "tenant-" + tenant, Params: map[string]string{"tenant": tenant}})
+			done <- result
+		}()
+		<-started
+		return done
+	}
+	tenant42, tenant7 := run("42"), run("7")
+
+	if _, err := cli.StopMatching(context.Background(), client.StopFilter{}, "all"); !errors.Is(err, client.ErrInvalidTask) {
+		t.Fatalf("an empty filter should be refused, got %v", err)
+	}
+	stopped, err := cli.StopMatching(context.Background(), client.StopFilter{Job: "reindex", Params: map[string]string{"tenant": "42"}}, "incident")
+	if err != nil || stopped != 1 {
+		t.Fatalf("expected one run stopped, got %d, %v", stopped, err)
+	}
+	if result := <-tenant42; result.Status != base.INTERRUPT || result.StopReason != "incident" {
+		t.Fatalf("unexpected result of the stopped run: %+v", result)
+	}
+
+	if _, err := cli.RunContext(context.Background(), &client.Task{Name: "reindex", Stop: true, Signature: "tenant-7", StopReason: "done"}); err != nil {
+		t.Fatalf("stop failed: %v", err)
+	}
+	if result := <-tenant7; result.StopReason != "done" {
+		t.Fatalf("the stop reason should reach the run's result: %+v", result)
+	}
+}
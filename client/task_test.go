@@ -0,0 +1,72 @@
+package client
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestQueryStringPrecedence(t *testing.T) {
+	cases := []struct {
+		name string
+		task Task
+		want url.Values
+	}{
+		{
+			name: "params win over args",
+			task: Task{Args: "id=1&env=dev", Params: map[string]string{"id": "2"}},
+			want: url.Values{"id": {"2"}, "env": {"dev"}},
+		},
+		{
+			name: "args keep only the first value by default",
+			task: Task{Args: "shard=1&shard=2"},
+			want: url.Values{"shard": {"1"}},
+		},
+		{
+			name: "multi value keeps repeated args in order",
+			task: Task{Args: "shard=3&shard=1&shard=2", MultiValue: true},
+			want: url.Values{"shard": {"3", "1", "2"}},
+		},
+		{
+			name: "values keep order and win over args",
+			task: Task{Args: "shard=9&env=dev", Values: url.Values{"shard": {"2", "1"}}, MultiValue: true},
+			want: url.Values{"shard": {"2", "1"}, "env": {"dev"}},
+		},
+		{
+			name: "params come before values for the same key",
+			task: Task{Params: map[string]string{"shard": "0"}, Values: url.Values{"shard": {"1", "2"}}},
+			want: url.Values{"shard": {"0", "1", "2"}},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			query, err := tc.task.queryString()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got, err := url.ParseQuery(query)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestKeyValueFlagMulti(t *testing.T) {
+	var f keyValueFlag
+	for _, value := range []string{"shard=1", "env=dev", "shard=2"} {
+		if err := f.Set(value); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if f.values["shard"] != "2" {
+		t.Fatalf("expected last value to win in the map, got %q", f.values["shard"])
+	}
+	want := url.Values{"shard": {"1", "2"}, "env": {"dev"}}
+	if got := f.all(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
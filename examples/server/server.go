@@ -13,7 +13,8 @@ func main() {
 			fmt.Printf("%v: %v\n", k, v)
 		}
 		return true
-	}); err != nil {
+	}, server.WithParam("id"), server.WithParam("ver", "1", "2"),
+		server.WithDescription("Print the args it was run with"), server.WithTags("demo")); err != nil {
 		panic(err)
 	}
 
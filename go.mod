@@ -1,5 +1,5 @@
 module github.com/Kingson4Wu/saturncli
 
-go 1.19
+go 1.20
 
 require github.com/google/uuid v1.3.1
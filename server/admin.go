@@ -0,0 +1,62 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/Kingson4Wu/saturncli/base"
+)
+
+// serveAdmin answers the built-in endpoints living under base.AdminPathPrefix.
+// Requests about a single job of a mounted registry are handed to its mount;
+// events of mounts are republished and queues are shared with them, so the
+// event stream and the queue listing are always served here.
+func (s *ser) serveAdmin(rw http.ResponseWriter, r *http.Request) {
+	if job := r.URL.Query().Get("job"); job != "" && r.URL.Path != base.EventsPath && r.URL.Path != base.QueuePath && s.serveMounted(rw, r, job) {
+		return
+	}
+	switch r.URL.Path {
+	case base.JobsPath:
+		query := r.URL.Query()
+		s.writeJSON(rw, http.StatusOK, s.jobInfos(query.Get("match"), query.Get("tag"), query.Get("hidden") == "true", callerOf(r)))
+	case base.BatchPath:
+		if !s.serveMountedBatch(rw, r) {
+			s.runBatch(rw, r)
+		}
+	case base.HistoryPath:
+		// history holds every run's args and results, so ACLs apply to reading it
+		if job := r.URL.Query().Get("job"); job == "" || s.authorize(rw, r, job) {
+			s.writeJSON(rw, http.StatusOK, s.history(job, callerOf(r)))
+		}
+	case base.EventsPath:
+		s.streamEvents(rw, r)
+	case base.RunsPath:
+		if job := r.URL.Query().Get("job"); job == "" || s.authorize(rw, r, job) {
+			s.writeJSON(rw, http.StatusOK, s.runs(job, callerOf(r)))
+		}
+	case base.PausePath:
+		s.controlRun(rw, r, true)
+	case base.ResumePath:
+		s.controlRun(rw, r, false)
+	case base.DisablePath:
+		s.toggleJob(rw, r, true)
+	case base.EnablePath:
+		s.toggleJob(rw, r, false)
+	case base.QueuePath:
+		s.writeJSON(rw, http.StatusOK, s.queueInfos(callerOf(r)))
+	case base.StopPath:
+		s.stopFiltered(rw, r)
+	default:
+		rw.WriteHeader(http.StatusNotFound)
+		_, _ = rw.Write([]byte(base.NOT_EXIST))
+		s.logger.Warnf("saturn server admin endpoint not exist, path:%s", r.URL.Path)
+	}
+}
+
+func (s *ser) writeJSON(rw http.ResponseWriter, status int, v any) {
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(status)
+	if err := json.NewEncoder(rw).Encode(v); err != nil {
+		s.logger.Warnf("saturn server failed to encode response: %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/Kingson4Wu/saturncli/base"
+	"github.com/google/uuid"
+)
+
+const (
+	maxBatchConcurrency = 32
+	maxBatchBodyBytes   = 32 << 20
+)
+
+// runBatch executes every item of a base.BatchRequest against one job with a
+// bounded number of concurrent runs. If the caller goes away, items that have
+// not started are reported as interrupted and running stoppable items are
+// asked to stop.
+func (s *ser) runBatch(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.writeJSON(rw, http.StatusMethodNotAllowed, base.Response{Status: base.FAILURE, Message: "batch requires POST"})
+		return
+	}
+	var req base.BatchRequest
+	if err := json.NewDecoder(http.MaxBytesReader(rw, r.Body, maxBatchBodyBytes)).Decode(&req); err != nil {
+		s.writeJSON(rw, http.StatusBadRequest, base.Response{Status: base.FAILURE, Message: "invalid batch request: " + err.Error()})
+		return
+	}
+	job, ok := s.registry.getJob(req.Job)
+	if !ok {
+		s.writeJSON(rw, http.StatusNotFound, base.Response{Status: base.NOT_EXIST, Job: s.qualify(req.Job), Message: "job is not registered"})
+		s.logger.Warnf("saturn server batch job not exist, name:%s", req.Job)
+		return
+	}
+	if !s.authorize(rw, r, job.name) {
+		return
+	}
+
+	concurrency := req.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	if concurrency > maxBatchConcurrency {
+		concurrency = maxBatchConcurrency
+	}
+	s.logger.Infof("saturn server batch run, name:%s, items: %d, concurrency: %d", job.name, len(req.Items), concurrency)
+
+	for i := range req.Items {
+		if req.Items[i].Signature == "" {
+			if v, err := uuid.NewUUID(); err == nil {
+				req.Items[i].Signature = v.String()
+			}
+		}
+	}
+
+	ctx := r.Context()
+	caller := callerOf(r)
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Done():
+			for _, item := range req.Items {
+				s.registry.stopWithReason(job.name, item.Signature, "batch was cancelled")
+			}
+		case <-finished:
+		}
+	}()
+
+	results := make([]base.Response, len(req.Items))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, item := range req.Items {
+		select {
+		case sem <- struct{}{}:
+			if ctx.Err() == nil {
+				wg.Add(1)
+				go func(i int, item base.BatchItem) {
+					defer wg.Done()
+					defer func() { <-sem }()
+					args := item.Params
+					if args == nil {
+						args = map[string]string{}
+					}
+					values := url.Values{}
+					for k, v := range args {
+						values.Set(k, v)
+					}
+					results[i] = s.execute(invocation{job: job, args: args, values: values, signature: item.Signature, cancel: ctx.Done(), caller: &caller})
+				}(i, item)
+				continue
+			}
+			<-sem
+		case <-ctx.Done():
+		}
+		results[i] = base.Response{Status: base.INTERRUPT, Job: job.name, Signature: item.Signature, Message: "batch cancelled before item started"}
+	}
+	wg.Wait()
+
+	for i := range results {
+		results[i].Job = s.qualify(results[i].Job)
+	}
+	s.writeJSON(rw, http.StatusOK, base.BatchResponse{Job: s.qualify(job.name), Results: results})
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// ErrNoCheckpointStore is returned by the checkpoint methods of JobRequest
+// when the server has no CheckpointStore.
+var ErrNoCheckpointStore = errors.New("no checkpoint store configured")
+
+// CheckpointStore persists the opaque cursors handlers save so a run can be
+// resumed after a restart. Implementations must be safe for concurrent use.
+type CheckpointStore interface {
+	// Save replaces the checkpoint of the run.
+	Save(job, signature string, cursor []byte) error
+	// Load returns the checkpoint of the run; ok is false when there is none.
+	Load(job, signature string) (cursor []byte, ok bool, err error)
+	// Delete forgets the checkpoint of the run; deleting a missing one is not an error.
+	Delete(job, signature string) error
+}
+
+// WithCheckpointStore sets where handlers' checkpoints are kept. By default a
+// server with a socket path keeps them in files next to the socket, in the
+// directory sockPath + ".checkpoints".
+func WithCheckpointStore(store CheckpointStore) ServerOption {
+	return func(s *ser) {
+		s.checkpoints = store
+	}
+}
+
+// FileCheckpointStore keeps each checkpoint in its own file, dir/job/signature.
+// Files are replaced atomically, so a crash while saving leaves the previous
+// checkpoint intact.
+type FileCheckpointStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// NewFileCheckpointStore returns a store rooted at dir, created on first save.
+func NewFileCheckpointStore(dir string) *FileCheckpointStore {
+	return &FileCheckpointStore{dir: dir}
+}
+
+func (f *FileCheckpointStore) path(job, signature string) (string, error) {
+	for _, name := range []string{job, signature} {
+		if name == "" || name == "." || name == ".." {
+			return "", fmt.Errorf("invalid checkpoint key %q", name)
+		}
+	}
+	return filepath.Join(f.dir, url.PathEscape(job), url.PathEscape(signature)), nil
+}
+
+// Save implements CheckpointStore.
+func (f *FileCheckpointStore) Save(job, signature string, cursor []byte) error {
+	path, err := f.path(job, signature)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".checkpoint-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(cursor); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Load implements CheckpointStore.
+func (f *FileCheckpointStore) Load(job, signature string) ([]byte, bool, error) {
+	path, err := f.path(job, signature)
+	if err != nil {
+		return nil, false, err
+	}
+	cursor, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return cursor, true, nil
+}
+
+// Delete implements CheckpointStore.
+func (f *FileCheckpointStore) Delete(job, signature string) error {
+	path, err := f.path(job, signature)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// checkResume reports why signature cannot be resumed as a run of job, or nil.
+func (s *ser) checkResume(job *notifyJob, signature string) error {
+	if job.request == nil {
+		return errors.New("only request-style jobs can be resumed")
+	}
+	if s.checkpoints == nil {
+		return ErrNoCheckpointStore
+	}
+	if _, running := s.registry.activeRun(job.name, signature); running {
+		return fmt.Errorf("run %s is still in flight", signature)
+	}
+	_, ok, err := s.checkpoints.Load(job.name, signature)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("run %s has no checkpoint", signature)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/Kingson4Wu/saturncli/base"
+	"github.com/Kingson4Wu/saturncli/utils"
+)
+
+func TestFileCheckpointStore(t *testing.T) {
+	store := NewFileCheckpointStore(filepath.Join(t.TempDir(), "checkpoints"))
+	if _, ok, err := store.Load("migrate", "s1"); ok || err != nil {
+		t.Fatalf("expected no checkpoint, got %v, %v", ok, err)
+	}
+	for _, cursor := range []string{"10", "20"} {
+		if err := store.Save("migrate/users", "s1", []byte(cursor)); err != nil {
+			t.Fatalf("save failed: %v", err)
+		}
+	}
+	if cursor, ok, err := store.Load("migrate/users", "s1"); !ok || err != nil || string(cursor) != "20" {
+		t.Fatalf("expected the latest cursor, got %q, %v, %v", cursor, ok, err)
+	}
+	if err := store.Delete("migrate/users", "s1"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if _, ok, _ := store.Load("migrate/users", "s1"); ok {
+		t.Fatal("checkpoint survived delete")
+	}
+	if err := store.Save("migrate", "..", nil); err == nil {
+		t.Fatal("expected a path-like signature to be rejected")
+	}
+}
+
+func TestResumeFromCheckpoint(t *testing.T) {
+	registry := NewRegistry()
+	var seen []int
+	failAt := 3
+	if err := registry.AddRequestJob("migrate", func(req *JobRequest) bool {
+		cursor, err := req.Checkpoint()
+		if err != nil {
+			return false
+		}
+		next := 0
+		if cursor != nil {
+			next, _ = strconv.Atoi(string(cursor))
+		}
+		for ; next < 5; next++ {
+			if next == failAt {
+				return false
+			}
+			seen = append(seen, next)
+			if err := req.SaveCheckpoint([]byte(strconv.Itoa(next + 1))); err != nil {
+				return false
+			}
+		}
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+
+	srv := NewServer(&utils.DefaultLogger{}, filepath.Join(t.TempDir(), "saturn.sock"), WithRegistry(registry))
+	run := func(resume string) base.Response {
+		req := httptest.NewRequest(http.MethodGet, "/migrate", nil)
+		req.Header.Set(base.RunSignature, "m-1")
+		if resume != "" {
+			req.Header.Set(base.ResumeRun, resume)
+		}
+		return serveJSON(t, srv, req)
+	}
+	if resp := run(""); resp.Status != base.FAILURE {
+		t.Fatalf("expected the first run to fail, got %+v", resp)
+	}
+
+	failAt = -1
+	if resp := run("m-1"); resp.Status != base.SUCCESS || resp.Signature != "m-1" {
+		t.Fatalf("expected the resumed run to succeed, got %+v", resp)
+	}
+	if len(seen) != 5 || seen[3] != 3 {
+		t.Fatalf("expected the resumed run to continue at 3, processed %v", seen)
+	}
+	if resp := run("m-1"); resp.Status != base.FAILURE || resp.Message != "resume: run m-1 has no checkpoint" {
+		t.Fatalf("a finished run should have no checkpoint left, got %+v", resp)
+	}
+}
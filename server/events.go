@@ -0,0 +1,286 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+)
+
+const (
+	// recentEventsSize bounds the backlog replayed to new event streams.
+	recentEventsSize  = 100
+	eventStreamPingIn = 15 * time.Second
+	// maxStreamPendingEvents bounds the events queued for one event stream
+	// whose client does not keep up.
+	maxStreamPendingEvents = 1024
+)
+
+// eventBus fans events out to subscribers. Every subscriber owns a queue
+// drained by its own goroutine, so publishing never blocks a job. In-process
+// subscribers never lose or reorder events; event streams have a bounded
+// queue that drops its oldest events, noted by an EventDropped marker.
+type eventBus struct {
+	mu     sync.Mutex
+	nextID int
+	subs   map[int]*subscriber
+	recent []base.Event
+}
+
+type subscriber struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []base.Event
+	closed  bool
+	done    chan struct{}
+	// limit caps pending when positive; dropped counts events lost to it
+	// since the last marker.
+	limit   int
+	dropped int
+}
+
+func newSubscriber() *subscriber {
+	sub := &subscriber{done: make(chan struct{})}
+	sub.cond = sync.NewCond(&sub.mu)
+	return sub
+}
+
+func (sub *subscriber) push(event base.Event) {
+	sub.mu.Lock()
+	if !sub.closed {
+		if sub.limit > 0 && len(sub.pending) >= sub.limit {
+			sub.pending = sub.pending[1:]
+			sub.dropped++
+		}
+		sub.pending = append(sub.pending, event)
+		sub.cond.Signal()
+	}
+	sub.mu.Unlock()
+}
+
+// next blocks until an event is queued, returning false once closed. When
+// events were dropped, an EventDropped marker comes before the ones kept.
+func (sub *subscriber) next() (base.Event, bool) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+	for len(sub.pending) == 0 && !sub.closed {
+		sub.cond.Wait()
+	}
+	if sub.closed {
+		return base.Event{}, false
+	}
+	if sub.dropped > 0 {
+		marker := base.Event{Type: base.EventDropped, Time: time.Now(), Message: fmt.Sprintf("%d events dropped, the reader fell behind", sub.dropped)}
+		sub.dropped = 0
+		return marker, true
+	}
+	event := sub.pending[0]
+	sub.pending = sub.pending[1:]
+	return event, true
+}
+
+func (sub *subscriber) close() {
+	sub.mu.Lock()
+	if !sub.closed {
+		close(sub.done)
+	}
+	sub.closed = true
+	sub.pending = nil
+	sub.cond.Broadcast()
+	sub.mu.Unlock()
+}
+
+func (b *eventBus) add(sub *subscriber) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.addLocked(sub)
+}
+
+func (b *eventBus) addLocked(sub *subscriber) func() {
+	if b.subs == nil {
+		b.subs = make(map[int]*subscriber)
+	}
+	id := b.nextID
+	b.nextID++
+	b.subs[id] = sub
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, id)
+			b.mu.Unlock()
+			sub.close()
+		})
+	}
+}
+
+func (b *eventBus) publish(event base.Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.recent) == recentEventsSize {
+		copy(b.recent, b.recent[1:])
+		b.recent = b.recent[:recentEventsSize-1]
+	}
+	b.recent = append(b.recent, event)
+	for _, sub := range b.subs {
+		sub.push(event)
+	}
+}
+
+// snapshotAndAdd registers sub and returns the recent backlog atomically, so
+// a stream neither misses nor repeats an event between the two.
+func (b *eventBus) snapshotAndAdd(sub *subscriber) ([]base.Event, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]base.Event(nil), b.recent...), b.addLocked(sub)
+}
+
+// Subscribe calls fn for every event published on the registry until the
+// returned cancel function is called. Calls are made in publish order from a
+// goroutine dedicated to this subscriber.
+func (r *Registry) Subscribe(fn func(base.Event)) (cancel func()) {
+	sub := newSubscriber()
+	cancel = r.events.add(sub)
+	go func() {
+		for {
+			event, ok := sub.next()
+			if !ok {
+				return
+			}
+			fn(event)
+		}
+	}()
+	return cancel
+}
+
+// SubscribeChan delivers every event published on the registry to the
+// returned channel, which is closed once cancel is called. Events queue up
+// behind a slow reader rather than being dropped.
+func (r *Registry) SubscribeChan() (<-chan base.Event, func()) {
+	ch := make(chan base.Event)
+	sub := newSubscriber()
+	cancel := r.events.add(sub)
+	go func() {
+		defer close(ch)
+		for {
+			event, ok := sub.next()
+			if !ok {
+				return
+			}
+			select {
+			case ch <- event:
+			case <-sub.done:
+				return
+			}
+		}
+	}()
+	return ch, cancel
+}
+
+// RecentEvents returns the latest published events, oldest first.
+func (r *Registry) RecentEvents() []base.Event {
+	r.events.mu.Lock()
+	defer r.events.mu.Unlock()
+	return append([]base.Event(nil), r.events.recent...)
+}
+
+func (r *Registry) publish(event base.Event) {
+	r.events.publish(event)
+}
+
+// streamEvents serves the event bus as server-sent events. The recent backlog
+// is sent first; with follow=true the stream then stays open for new events.
+// Events of jobs the caller may not use are left out.
+func (s *ser) streamEvents(rw http.ResponseWriter, r *http.Request) {
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		s.writeJSON(rw, http.StatusInternalServerError, base.Response{Status: base.FAILURE, Message: "streaming unsupported"})
+		return
+	}
+	query := r.URL.Query()
+	job := query.Get("job")
+	follow := query.Get("follow") == "true"
+	caller := callerOf(r)
+
+	sub := newSubscriber()
+	sub.limit = maxStreamPendingEvents
+	var recent []base.Event
+	if follow {
+		var cancel func()
+		recent, cancel = s.registry.events.snapshotAndAdd(sub)
+		defer cancel()
+	} else {
+		recent = s.registry.RecentEvents()
+	}
+
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.WriteHeader(http.StatusOK)
+
+	write := func(event base.Event) bool {
+		if job != "" && event.Job != job && event.Type != base.EventDropped {
+			return true
+		}
+		if event.Job != "" && !s.allows(event.Job, caller) {
+			return true
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			return true
+		}
+		if _, err := fmt.Fprintf(rw, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+			return false
+		}
+		return true
+	}
+	for _, event := range recent {
+		if !write(event) {
+			return
+		}
+	}
+	flusher.Flush()
+	if !follow {
+		return
+	}
+
+	events := make(chan base.Event)
+	go func() {
+		defer close(events)
+		for {
+			event, ok := sub.next()
+			if !ok {
+				return
+			}
+			select {
+			case events <- event:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}()
+	ping := time.NewTicker(eventStreamPingIn)
+	defer ping.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok || !write(event) {
+				return
+			}
+			flusher.Flush()
+		case <-ping.C:
+			if _, err := fmt.Fprint(rw, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
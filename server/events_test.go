@@ -0,0 +1,147 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+	"github.com/Kingson4Wu/saturncli/utils"
+)
+
+func TestEventsLifecycle(t *testing.T) {
+	registry := NewRegistry()
+	if err := registry.AddRequestJob("report", func(req *JobRequest) bool {
+		req.ReportProgress(50, "half way")
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	if err := registry.AddStoppableJob("slow", func(args map[string]string, signature string, quit chan struct{}) bool {
+		<-quit
+		return true
+	}, WithTimeout(50*time.Millisecond)); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+
+	events, cancel := registry.SubscribeChan()
+	defer cancel()
+	var callbacks []string
+	done := make(chan struct{})
+	stopCallbacks := registry.Subscribe(func(event base.Event) {
+		callbacks = append(callbacks, event.Type)
+		if len(callbacks) == 5 {
+			close(done)
+		}
+	})
+	defer stopCallbacks()
+
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry))
+	if resp := serveJSON(t, srv, httptest.NewRequest(http.MethodGet, "/report", nil)); resp.Status != base.SUCCESS {
+		t.Fatalf("unexpected reply: %+v", resp)
+	}
+	resp := serveJSON(t, srv, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if resp.Status != base.TIMEOUT {
+		t.Fatalf("expected the slow job to time out, got %+v", resp)
+	}
+
+	want := []string{base.EventStarted, base.EventProgress, base.EventSucceeded, base.EventStarted, base.EventTimedOut}
+	for i, typ := range want {
+		select {
+		case event := <-events:
+			if event.Type != typ {
+				t.Fatalf("event %d: expected %s, got %+v", i, typ, event)
+			}
+			if typ == base.EventProgress && (event.Percent != 50 || event.Message != "half way" || event.Signature == "") {
+				t.Fatalf("unexpected progress event: %+v", event)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("event %d (%s) not delivered", i, typ)
+		}
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("callback subscriber missed events")
+	}
+	if strings.Join(callbacks, ",") != strings.Join(want, ",") {
+		t.Fatalf("callbacks saw %v", callbacks)
+	}
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, base.EventsPath+"?job=slow", nil))
+	body := rec.Body.String()
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/event-stream") ||
+		!strings.Contains(body, "event: timed_out\n") || strings.Contains(body, `"job":"report"`) {
+		t.Fatalf("unexpected event stream: %q", body)
+	}
+}
+
+func TestStreamSubscriberDropsOldest(t *testing.T) {
+	sub := newSubscriber()
+	sub.limit = 2
+	for _, signature := range []string{"1", "2", "3", "4", "5"} {
+		sub.push(base.Event{Type: base.EventStarted, Job: "report", Signature: signature})
+	}
+	var got []string
+	for i := 0; i < 3; i++ {
+		event, ok := sub.next()
+		if !ok {
+			t.Fatal("subscriber closed early")
+		}
+		got = append(got, event.Type+":"+event.Signature+event.Message)
+	}
+	want := []string{base.EventDropped + ":3 events dropped, the reader fell behind", base.EventStarted + ":4", base.EventStarted + ":5"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestEventStreamHidesRefusedJobs(t *testing.T) {
+	ok := func(map[string]string, string) bool { return true }
+	registry, ops := NewRegistry(), NewRegistry()
+	if err := registry.Group("billing").AddJob("send", ok); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	if err := registry.AddJob("cleanup", ok); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	if err := ops.Group("private").AddJob("purge", ok); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	registry.Group("billing").SetACL(AllowUIDs(8))
+	ops.Group("private").SetACL(AllowUIDs(8))
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry))
+	if err := srv.Mount("ops", ops); err != nil {
+		t.Fatalf("mount failed: %v", err)
+	}
+	events, cancel := registry.SubscribeChan()
+	defer cancel()
+	allowed := Caller{UID: 8, Known: true}
+	for _, target := range []string{"/billing.send", "/cleanup", "/ops.private.purge"} {
+		if resp := serveJSON(t, srv, withCaller(httptest.NewRequest(http.MethodGet, target, nil), allowed)); resp.Status != base.SUCCESS {
+			t.Fatalf("%s: unexpected reply %+v", target, resp)
+		}
+	}
+	// events of the mount are republished asynchronously
+	for event := range events {
+		if event.Job == "ops.private.purge" && event.Type == base.EventSucceeded {
+			break
+		}
+	}
+
+	stream := func(caller Caller) string {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, withCaller(httptest.NewRequest(http.MethodGet, base.EventsPath, nil), caller))
+		return rec.Body.String()
+	}
+	if body := stream(Caller{}); !strings.Contains(body, `"job":"cleanup"`) ||
+		strings.Contains(body, "billing.send") || strings.Contains(body, "ops.private.purge") {
+		t.Fatalf("the stream should hide events of jobs the caller may not use: %q", body)
+	}
+	if body := stream(allowed); !strings.Contains(body, `"job":"billing.send"`) || !strings.Contains(body, `"job":"ops.private.purge"`) {
+		t.Fatalf("an allowed caller should see every event: %q", body)
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+)
+
+const (
+	defaultIdempotencyWindow = 10 * time.Minute
+	// maxIdempotencyKeys bounds how many finished runs are remembered for
+	// deduplication, however short their window.
+	maxIdempotencyKeys = 1024
+)
+
+// WithIdempotencyWindow sets how long the reply of a finished run is kept for
+// requests repeating its idempotency key (default 10 minutes). A repeated key
+// gets the recorded reply, or waits for the run still in flight, instead of
+// running the job again. Keys come from the idempotency_key header, else from
+// the run signature. A window of zero turns deduplication off.
+func WithIdempotencyWindow(window time.Duration) ServerOption {
+	return func(s *ser) {
+		s.idempotency.setWindow(window)
+	}
+}
+
+var errIdempotencyAbandoned = errors.New("run was abandoned while waiting for the run with the same idempotency key")
+
+type idempotencyKey struct {
+	job, key string
+}
+
+// idempotentRun is the run holding an idempotency key. done is closed when
+// it finishes; runs rejected before executing release the key instead of
+// recording a reply.
+type idempotentRun struct {
+	done     chan struct{}
+	executed bool
+	resp     base.Response
+	finished time.Time
+}
+
+// idempotencyCache remembers runs by idempotency key for a window after they
+// finish.
+type idempotencyCache struct {
+	mu     sync.Mutex
+	window time.Duration
+	runs   map[idempotencyKey]*idempotentRun
+	// finished lists the keys of recorded replies, oldest first.
+	finished []idempotencyKey
+}
+
+func newIdempotencyCache() *idempotencyCache {
+	return &idempotencyCache{window: defaultIdempotencyWindow, runs: make(map[idempotencyKey]*idempotentRun)}
+}
+
+func (c *idempotencyCache) setWindow(window time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.window = window
+}
+
+func (c *idempotencyCache) enabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.window > 0
+}
+
+// acquire makes the caller the holder of key, waiting while a run in flight
+// holds it. It returns the run holding key and whether that is the caller's;
+// otherwise the run has finished and its reply is to be replayed. Waiting
+// ends early when cancel is closed.
+func (c *idempotencyCache) acquire(key idempotencyKey, cancel <-chan struct{}) (*idempotentRun, bool, error) {
+	for {
+		c.mu.Lock()
+		c.expireLocked(time.Now())
+		run, ok := c.runs[key]
+		if !ok {
+			run = &idempotentRun{done: make(chan struct{})}
+			c.runs[key] = run
+		}
+		c.mu.Unlock()
+		if !ok {
+			return run, true, nil
+		}
+		select {
+		case <-run.done:
+		case <-cancel:
+			return nil, false, errIdempotencyAbandoned
+		}
+		if run.executed {
+			return run, false, nil
+		}
+	}
+}
+
+// finish records the reply of the run holding key, or releases key when the
+// run never executed.
+func (c *idempotencyCache) finish(key idempotencyKey, run *idempotentRun, resp base.Response, executed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if executed {
+		run.executed, run.resp, run.finished = true, resp, time.Now()
+		c.finished = append(c.finished, key)
+	} else {
+		delete(c.runs, key)
+	}
+	close(run.done)
+}
+
+func (c *idempotencyCache) expireLocked(now time.Time) {
+	for len(c.finished) > 0 {
+		key := c.finished[0]
+		if len(c.finished) <= maxIdempotencyKeys && now.Sub(c.runs[key].finished) < c.window {
+			return
+		}
+		delete(c.runs, key)
+		c.finished = c.finished[1:]
+	}
+}
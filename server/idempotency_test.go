@@ -0,0 +1,124 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+	"github.com/Kingson4Wu/saturncli/utils"
+)
+
+func TestIdempotentRunsReplay(t *testing.T) {
+	registry := NewRegistry()
+	var runs atomic.Int32
+	if err := registry.AddRequestJob("charge", func(req *JobRequest) bool {
+		_ = req.SetResult(runs.Add(1))
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry))
+	run := func(header, value string) base.Response {
+		req := httptest.NewRequest(http.MethodGet, "/charge", nil)
+		req.Header.Set(header, value)
+		return serveJSON(t, srv, req)
+	}
+
+	first := run(base.RunSignature, "order-1")
+	if first.Status != base.SUCCESS || first.Replayed {
+		t.Fatalf("the first run should execute, got %+v", first)
+	}
+	again := run(base.RunSignature, "order-1")
+	if !again.Replayed || again.Signature != "order-1" || string(again.Result) != "1" || runs.Load() != 1 {
+		t.Fatalf("a repeated signature should replay the first run, got %+v after %d runs", again, runs.Load())
+	}
+	if resp := run(base.IdempotencyKey, "order-2"); resp.Replayed || runs.Load() != 2 {
+		t.Fatalf("a new key should run the job, got %+v", resp)
+	}
+	if resp := run(base.IdempotencyKey, "order-2"); !resp.Replayed || string(resp.Result) != "2" {
+		t.Fatalf("a repeated key should replay its run, got %+v", resp)
+	}
+	if got := len(registry.History("charge")); got != 2 {
+		t.Fatalf("replays should not be recorded as runs, got %d", got)
+	}
+
+	if err := registry.DisableJob("charge", "maintenance"); err != nil {
+		t.Fatalf("disable failed: %v", err)
+	}
+	if resp := run(base.IdempotencyKey, "order-3"); resp.Status != base.DISABLED {
+		t.Fatalf("expected the disabled job to refuse, got %+v", resp)
+	}
+	if err := registry.EnableJob("charge"); err != nil {
+		t.Fatalf("enable failed: %v", err)
+	}
+	if resp := run(base.IdempotencyKey, "order-3"); resp.Status != base.SUCCESS || resp.Replayed {
+		t.Fatalf("a refused run should not hold its key, got %+v", resp)
+	}
+}
+
+func TestIdempotentRunInFlight(t *testing.T) {
+	registry := NewRegistry()
+	started, release := make(chan struct{}, 2), make(chan struct{})
+	if err := registry.AddJob("export", func(map[string]string, string) bool {
+		started <- struct{}{}
+		<-release
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry))
+	run := func() <-chan *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/export", nil)
+		req.Header.Set(base.IdempotencyKey, "nightly")
+		return serveAsync(srv, req)
+	}
+	first := run()
+	<-started
+	second := run()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	for i, done := range []<-chan *httptest.ResponseRecorder{first, second} {
+		resp := decodeReply(t, <-done)
+		if resp.Status != base.SUCCESS || resp.Replayed != (i == 1) {
+			t.Fatalf("run %d: unexpected reply %+v", i+1, resp)
+		}
+	}
+	if len(started) != 0 {
+		t.Fatal("the retry should wait for the run in flight instead of starting another")
+	}
+}
+
+func TestIdempotencyWindow(t *testing.T) {
+	registry := NewRegistry()
+	var runs atomic.Int32
+	if err := registry.AddJob("ping", func(map[string]string, string) bool {
+		runs.Add(1)
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	run := func(srv http.Handler) {
+		req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+		req.Header.Set(base.RunSignature, "same")
+		serveJSON(t, srv, req)
+	}
+
+	short := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry), WithIdempotencyWindow(30*time.Millisecond))
+	run(short)
+	run(short)
+	time.Sleep(50 * time.Millisecond)
+	run(short)
+	if runs.Load() != 2 {
+		t.Fatalf("the key should expire after its window, got %d runs", runs.Load())
+	}
+
+	off := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry), WithIdempotencyWindow(0))
+	run(off)
+	run(off)
+	if runs.Load() != 4 {
+		t.Fatalf("a zero window should turn deduplication off, got %d runs", runs.Load())
+	}
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Kingson4Wu/saturncli/base"
+)
+
+// RemoveJob unregisters a job from the package-level registry.
+func RemoveJob(name string) error {
+	return defaultRegistry.RemoveJob(name)
+}
+
+// ReplaceJob replaces a job in the package-level registry.
+func ReplaceJob(name string, handler JobHandler, opts ...JobOption) error {
+	return defaultRegistry.ReplaceJob(name, handler, opts...)
+}
+
+// ReplaceStoppableJob replaces a job in the package-level registry.
+func ReplaceStoppableJob(name string, handler StoppableJobHandler, opts ...JobOption) error {
+	return defaultRegistry.ReplaceStoppableJob(name, handler, opts...)
+}
+
+// ReplaceContextJob replaces a job in the package-level registry.
+func ReplaceContextJob(name string, handler ContextJobHandler, opts ...JobOption) error {
+	return defaultRegistry.ReplaceContextJob(name, handler, opts...)
+}
+
+// ReplaceRequestJob replaces a job in the package-level registry.
+func ReplaceRequestJob(name string, handler RequestJobHandler, opts ...JobOption) error {
+	return defaultRegistry.ReplaceRequestJob(name, handler, opts...)
+}
+
+// DisableJob disables a job of the package-level registry.
+func DisableJob(name, reason string) error {
+	return defaultRegistry.DisableJob(name, reason)
+}
+
+// EnableJob enables a job of the package-level registry.
+func EnableJob(name string) error {
+	return defaultRegistry.EnableJob(name)
+}
+
+// RemoveJob unregisters a job. Runs in flight finish normally; new runs are
+// answered as for any unknown job.
+func (r *Registry) RemoveJob(name string) error {
+	r.jobsMu.Lock()
+	defer r.jobsMu.Unlock()
+	if _, ok := r.jobs[name]; !ok {
+		return errors.New("the job is not registered")
+	}
+	delete(r.jobs, name)
+	delete(r.disabled, name)
+	return nil
+}
+
+// ReplaceJob swaps the handler of a registered job for a non-stoppable one.
+// Runs in flight finish with the handler they started with, and the job
+// stays disabled if it was. Options are not carried over from the old
+// registration.
+func (r *Registry) ReplaceJob(name string, handler JobHandler, opts ...JobOption) error {
+	if handler == nil {
+		return errors.New("handler is nil")
+	}
+	return r.putJob(&notifyJob{name: name, handler: handler}, opts, true)
+}
+
+// ReplaceStoppableJob swaps the handler of a registered job for a stoppable
+// one, like ReplaceJob.
+func (r *Registry) ReplaceStoppableJob(name string, handler StoppableJobHandler, opts ...JobOption) error {
+	if handler == nil {
+		return errors.New("handler is nil")
+	}
+	if err := r.putJob(&notifyJob{name: name, stoppable: handler}, opts, true); err != nil {
+		return err
+	}
+	r.ensureRunningMap(name)
+	return nil
+}
+
+// ReplaceContextJob swaps the handler of a registered job for a
+// context-aware one, like ReplaceJob.
+func (r *Registry) ReplaceContextJob(name string, handler ContextJobHandler, opts ...JobOption) error {
+	if handler == nil {
+		return errors.New("handler is nil")
+	}
+	if err := r.putJob(&notifyJob{name: name, contextual: handler}, opts, true); err != nil {
+		return err
+	}
+	r.ensureRunningMap(name)
+	return nil
+}
+
+// ReplaceRequestJob swaps the handler of a registered job for a
+// request-style one, like ReplaceJob.
+func (r *Registry) ReplaceRequestJob(name string, handler RequestJobHandler, opts ...JobOption) error {
+	if handler == nil {
+		return errors.New("handler is nil")
+	}
+	if err := r.putJob(&notifyJob{name: name, request: handler}, opts, true); err != nil {
+		return err
+	}
+	r.ensureRunningMap(name)
+	return nil
+}
+
+// DisableJob makes a job reject new runs with status DISABLED until it is
+// enabled again. Runs in flight are not affected; stop them separately.
+func (r *Registry) DisableJob(name, reason string) error {
+	if reason == "" {
+		reason = "disabled"
+	}
+	r.jobsMu.Lock()
+	if _, ok := r.jobs[name]; !ok {
+		r.jobsMu.Unlock()
+		return errors.New("the job is not registered")
+	}
+	r.disabled[name] = reason
+	r.jobsMu.Unlock()
+	r.publish(base.Event{Type: base.EventDisabled, Job: name, Message: reason})
+	return nil
+}
+
+// EnableJob lets a disabled job run again.
+func (r *Registry) EnableJob(name string) error {
+	r.jobsMu.Lock()
+	if _, ok := r.jobs[name]; !ok {
+		r.jobsMu.Unlock()
+		return errors.New("the job is not registered")
+	}
+	_, wasDisabled := r.disabled[name]
+	delete(r.disabled, name)
+	r.jobsMu.Unlock()
+	if wasDisabled {
+		r.publish(base.Event{Type: base.EventEnabled, Job: name})
+	}
+	return nil
+}
+
+// disabledReason reports why name is disabled, or false when it may run.
+func (r *Registry) disabledReason(name string) (string, bool) {
+	r.jobsMu.RLock()
+	defer r.jobsMu.RUnlock()
+	reason, ok := r.disabled[name]
+	return reason, ok
+}
+
+// toggleJob serves DisablePath and EnablePath for the job query parameter.
+func (s *ser) toggleJob(rw http.ResponseWriter, r *http.Request, disable bool) {
+	query := r.URL.Query()
+	name := query.Get("job")
+	if !s.authorize(rw, r, name) {
+		return
+	}
+	var err error
+	if disable {
+		err = s.registry.DisableJob(name, query.Get("reason"))
+	} else {
+		err = s.registry.EnableJob(name)
+	}
+	if err != nil {
+		s.reply(rw, r, http.StatusNotFound, base.Response{Status: base.NOT_EXIST, Job: name, Message: err.Error()})
+		return
+	}
+	if disable {
+		s.logger.Warnf("saturn server job disabled, name:%s, reason: %s", name, query.Get("reason"))
+	} else {
+		s.logger.Infof("saturn server job enabled, name:%s", name)
+	}
+	s.reply(rw, r, http.StatusOK, base.Response{Status: base.SUCCESS, Job: name})
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+	"github.com/Kingson4Wu/saturncli/utils"
+)
+
+func TestReplaceJobLetsRunsInFlightFinish(t *testing.T) {
+	registry := NewRegistry()
+	started, release := make(chan struct{}), make(chan struct{})
+	if err := registry.AddRequestJob("sync", func(req *JobRequest) bool {
+		close(started)
+		<-release
+		_ = req.SetResult("v1")
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry))
+	done := serveAsync(srv, httptest.NewRequest(http.MethodGet, "/sync", nil))
+	<-started
+
+	if err := registry.ReplaceRequestJob("sync", func(req *JobRequest) bool {
+		_ = req.SetResult("v2")
+		return true
+	}); err != nil {
+		t.Fatalf("replace failed: %v", err)
+	}
+	if resp := serveJSON(t, srv, httptest.NewRequest(http.MethodGet, "/sync", nil)); string(resp.Result) != `"v2"` {
+		t.Fatalf("new runs should use the replacement, got %+v", resp)
+	}
+	close(release)
+	select {
+	case rec := <-done:
+		if resp := decodeReply(t, rec); string(resp.Result) != `"v1"` {
+			t.Fatalf("the run in flight should finish with the old handler, got %+v", resp)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("run in flight did not finish")
+	}
+
+	if err := registry.ReplaceJob("missing", func(map[string]string, string) bool { return true }); err == nil {
+		t.Fatal("replacing an unknown job should fail")
+	}
+	if err := registry.RemoveJob("sync"); err != nil {
+		t.Fatalf("remove failed: %v", err)
+	}
+	if resp := serveJSON(t, srv, httptest.NewRequest(http.MethodGet, "/sync", nil)); resp.Status != base.NOT_EXIST {
+		t.Fatalf("removed job should not run, got %+v", resp)
+	}
+	if err := registry.AddJob("sync", func(map[string]string, string) bool { return true }); err != nil {
+		t.Fatalf("a removed name should be reusable: %v", err)
+	}
+}
+
+func TestDisableAndEnableJob(t *testing.T) {
+	registry := NewRegistry()
+	runs := 0
+	if err := registry.AddJob("purge", func(map[string]string, string) bool {
+		runs++
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry))
+
+	if resp := serveJSON(t, srv, httptest.NewRequest(http.MethodPost, base.DisablePath+"?job=purge&reason=incident+42", nil)); resp.Status != base.SUCCESS {
+		t.Fatalf("disable failed: %+v", resp)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/purge", nil)
+	req.Header.Set("Accept", base.JSONContentType)
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Code != http.StatusConflict || runs != 0 {
+		t.Fatalf("disabled job should be rejected with 409, got %d after %d runs", rec.Code, runs)
+	}
+	resp := serveJSON(t, srv, httptest.NewRequest(http.MethodGet, "/purge", nil))
+	if resp.Status != base.DISABLED || resp.Message != "job is disabled: incident 42" {
+		t.Fatalf("unexpected reply: %+v", resp)
+	}
+	if infos := registry.jobInfos("", false); infos[0].Disabled != "incident 42" {
+		t.Fatalf("disabled reason not surfaced: %+v", infos)
+	}
+
+	if err := registry.ReplaceJob("purge", func(map[string]string, string) bool { return true }); err != nil {
+		t.Fatalf("replace failed: %v", err)
+	}
+	if resp := serveJSON(t, srv, httptest.NewRequest(http.MethodGet, "/purge", nil)); resp.Status != base.DISABLED {
+		t.Fatalf("replacing should keep the job disabled, got %+v", resp)
+	}
+
+	if resp := serveJSON(t, srv, httptest.NewRequest(http.MethodPost, base.EnablePath+"?job=purge", nil)); resp.Status != base.SUCCESS {
+		t.Fatalf("enable failed: %+v", resp)
+	}
+	if resp := serveJSON(t, srv, httptest.NewRequest(http.MethodGet, "/purge", nil)); resp.Status != base.SUCCESS {
+		t.Fatalf("enabled job should run, got %+v", resp)
+	}
+	if resp := serveJSON(t, srv, httptest.NewRequest(http.MethodPost, base.DisablePath+"?job=missing", nil)); resp.Status != base.NOT_EXIST {
+		t.Fatalf("disabling an unknown job should fail, got %+v", resp)
+	}
+}
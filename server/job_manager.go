@@ -1,10 +1,19 @@
 package server
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/Kingson4Wu/saturncli/base"
 	"github.com/Kingson4Wu/saturncli/utils"
@@ -15,75 +24,243 @@ import (
 type JobHandler func(map[string]string, string) bool
 
 // StoppableJobHandler is invoked for cancellable jobs; implementations should
-// watch the quit channel and stop work promptly when it is closed.
+// watch the quit channel and stop work promptly when it is closed. The reason
+// given by the stop is then read with Registry.StopReason.
 type StoppableJobHandler func(map[string]string, string, chan struct{}) bool
 
+// ContextJobHandler is a JobHandler that also gets a context, done when the
+// run is stopped or times out, or when the caller goes away before the run
+// finishes, for example on CTRL+C in the CLI. context.Cause(ctx) is then a
+// *StopError carrying the reason.
+type ContextJobHandler func(ctx context.Context, args map[string]string, signature string) bool
+
 type notifyJob struct {
-	name      string
-	handler   JobHandler
-	stoppable StoppableJobHandler
+	name       string
+	handler    JobHandler
+	stoppable  StoppableJobHandler
+	contextual ContextJobHandler
+	request    RequestJobHandler
+	workflow   *Workflow
+	params     []base.ParamInfo
+	timeout    time.Duration
+	lockKey    string
+	lockTTL    time.Duration
+	queue      string
+
+	rateLimit       *rateLimiter
+	callerRateLimit *rateLimiter
+
+	description string
+	tags        []string
+	owner       string
+	deprecated  string
+	hidden      bool
+}
+
+// JobOption customises a job at registration time.
+type JobOption func(*notifyJob)
+
+// WithParam declares a parameter key the job understands, optionally limited
+// to a set of accepted values. Declarations are advisory and surface through
+// the discovery endpoint for tooling such as shell completion.
+func WithParam(name string, values ...string) JobOption {
+	return func(j *notifyJob) {
+		if strings.TrimSpace(name) == "" {
+			return
+		}
+		j.params = append(j.params, base.ParamInfo{Name: name, Values: append([]string(nil), values...)})
+	}
+}
+
+// WithTimeout stops a run that is still going after d, reporting it as timed
+// out. The run is stopped through its quit channel or context, so only
+// stoppable, context and request-style jobs can be cut short; other jobs are
+// left to finish.
+func WithTimeout(d time.Duration) JobOption {
+	return func(j *notifyJob) {
+		j.timeout = d
+	}
+}
+
+// WithDescription sets the human description shown by discovery and list.
+func WithDescription(description string) JobOption {
+	return func(j *notifyJob) {
+		j.description = description
+	}
+}
+
+// WithTags files the job under categories that list can filter on.
+func WithTags(tags ...string) JobOption {
+	return func(j *notifyJob) {
+		for _, tag := range tags {
+			if tag = strings.TrimSpace(tag); tag != "" && !containsString(j.tags, tag) {
+				j.tags = append(j.tags, tag)
+			}
+		}
+	}
+}
+
+// WithOwner names the team responsible for the job.
+func WithOwner(owner string) JobOption {
+	return func(j *notifyJob) {
+		j.owner = owner
+	}
+}
+
+// WithDeprecated marks the job deprecated; notice tells callers what to use
+// instead. Deprecated jobs still run, but each run logs a warning.
+func WithDeprecated(notice string) JobOption {
+	return func(j *notifyJob) {
+		j.deprecated = strings.TrimSpace(notice)
+		if j.deprecated == "" {
+			j.deprecated = "deprecated"
+		}
+	}
+}
+
+// WithHidden keeps an internal job out of discovery and completion unless
+// hidden jobs are asked for explicitly. It can still be run by name.
+func WithHidden() JobOption {
+	return func(j *notifyJob) {
+		j.hidden = true
+	}
 }
 
 func (j *notifyJob) isStoppable() bool {
-	return j != nil && j.stoppable != nil
+	return j != nil && (j.stoppable != nil || j.contextual != nil || j.request != nil || j.workflow != nil)
 }
 
-// Registry maintains registered jobs and their active stoppable invocations.
+// Registry maintains registered jobs, their active stoppable invocations and
+// a bounded history of finished runs.
 type Registry struct {
 	jobsMu    sync.RWMutex
 	jobs      map[string]*notifyJob
 	running   map[string]*sync.Map
 	runningMu sync.RWMutex
+	// disabled maps the names of disabled jobs to the reason given.
+	disabled map[string]string
+	// acls maps namespace names to the ACL set on them.
+	acls map[string]ACL
+	// reserved lists the namespaces where servers mount other registries.
+	reserved  []string
+	historyMu sync.Mutex
+	history   []base.RunRecord
+	events    eventBus
 }
 
+// historySize bounds how many finished runs a registry remembers.
+const historySize = 100
+
 // NewRegistry constructs an empty job registry for use with a Server.
 func NewRegistry() *Registry {
 	return &Registry{
-		jobs:    make(map[string]*notifyJob),
-		running: make(map[string]*sync.Map),
+		jobs:     make(map[string]*notifyJob),
+		running:  make(map[string]*sync.Map),
+		disabled: make(map[string]string),
+		acls:     make(map[string]ACL),
 	}
 }
 
 var defaultRegistry = NewRegistry()
 
 // AddJob registers a non-stoppable job in the package-level registry.
-func AddJob(name string, handler JobHandler) error {
-	return defaultRegistry.AddJob(name, handler)
+func AddJob(name string, handler JobHandler, opts ...JobOption) error {
+	return defaultRegistry.AddJob(name, handler, opts...)
 }
 
 // AddStoppableJob registers a stoppable job in the package-level registry.
-func AddStoppableJob(name string, handler StoppableJobHandler) error {
-	return defaultRegistry.AddStoppableJob(name, handler)
+func AddStoppableJob(name string, handler StoppableJobHandler, opts ...JobOption) error {
+	return defaultRegistry.AddStoppableJob(name, handler, opts...)
+}
+
+// AddContextJob registers a context-aware job in the package-level registry.
+func AddContextJob(name string, handler ContextJobHandler, opts ...JobOption) error {
+	return defaultRegistry.AddContextJob(name, handler, opts...)
+}
+
+// AddRequestJob registers a request-style job in the package-level registry.
+func AddRequestJob(name string, handler RequestJobHandler, opts ...JobOption) error {
+	return defaultRegistry.AddRequestJob(name, handler, opts...)
 }
 
 // AddJob registers a non-stoppable job against the receiver registry.
-func (r *Registry) AddJob(name string, handler JobHandler) error {
+func (r *Registry) AddJob(name string, handler JobHandler, opts ...JobOption) error {
 	if handler == nil {
 		return errors.New("handler is nil")
 	}
 	job := &notifyJob{name: name, handler: handler}
-	return r.registerJob(job)
+	return r.registerJob(job, opts)
 }
 
 // AddStoppableJob registers a stoppable job against the receiver registry.
-func (r *Registry) AddStoppableJob(name string, handler StoppableJobHandler) error {
+func (r *Registry) AddStoppableJob(name string, handler StoppableJobHandler, opts ...JobOption) error {
 	if handler == nil {
 		return errors.New("handler is nil")
 	}
-	r.ensureRunningMap(name)
 	job := &notifyJob{name: name, stoppable: handler}
-	return r.registerJob(job)
+	if err := r.registerJob(job, opts); err != nil {
+		return err
+	}
+	r.ensureRunningMap(name)
+	return nil
+}
+
+// AddContextJob registers a context-aware job against the receiver registry.
+// Its runs can be stopped, and are when their caller goes away.
+func (r *Registry) AddContextJob(name string, handler ContextJobHandler, opts ...JobOption) error {
+	if handler == nil {
+		return errors.New("handler is nil")
+	}
+	job := &notifyJob{name: name, contextual: handler}
+	if err := r.registerJob(job, opts); err != nil {
+		return err
+	}
+	r.ensureRunningMap(name)
+	return nil
+}
+
+// AddRequestJob registers a job whose handler receives the whole request,
+// including any body payload, against the receiver registry.
+func (r *Registry) AddRequestJob(name string, handler RequestJobHandler, opts ...JobOption) error {
+	if handler == nil {
+		return errors.New("handler is nil")
+	}
+	job := &notifyJob{name: name, request: handler}
+	if err := r.registerJob(job, opts); err != nil {
+		return err
+	}
+	r.ensureRunningMap(name)
+	return nil
 }
 
-func (r *Registry) registerJob(job *notifyJob) error {
-	if job == nil || strings.TrimSpace(job.name) == "" {
+func (r *Registry) registerJob(job *notifyJob, opts []JobOption) error {
+	return r.putJob(job, opts, false)
+}
+
+// putJob adds job, or with replace swaps it for the registered job of the
+// same name. Runs already in flight keep the handler they started with.
+func (r *Registry) putJob(job *notifyJob, opts []JobOption, replace bool) error {
+	if job == nil {
 		return errors.New("job name is empty")
 	}
+	if err := validateJobName(job.name); err != nil {
+		return err
+	}
+	for _, opt := range opts {
+		opt(job)
+	}
 	r.jobsMu.Lock()
 	defer r.jobsMu.Unlock()
-	if _, ok := r.jobs[job.name]; ok {
+	if prefix, ok := r.reservedFor(job.name); ok {
+		return fmt.Errorf("job name %s collides with the registry mounted at %s", job.name, prefix)
+	}
+	_, exists := r.jobs[job.name]
+	if exists && !replace {
 		return errors.New("the job is already exist")
 	}
+	if !exists && replace {
+		return errors.New("the job is not registered")
+	}
 	r.jobs[job.name] = job
 	return nil
 }
@@ -95,6 +272,78 @@ func (r *Registry) getJob(name string) (*notifyJob, bool) {
 	return job, ok
 }
 
+// jobInfos snapshots the registered jobs, sorted by name, for discovery.
+// Only jobs tagged tag are listed when it is not empty, and hidden jobs only
+// when includeHidden is set.
+func (r *Registry) jobInfos(tag string, includeHidden bool) []base.JobInfo {
+	r.jobsMu.RLock()
+	infos := make([]base.JobInfo, 0, len(r.jobs))
+	for _, job := range r.jobs {
+		if (job.hidden && !includeHidden) || (tag != "" && !containsString(job.tags, tag)) {
+			continue
+		}
+		infos = append(infos, base.JobInfo{
+			Name:        job.name,
+			Description: job.description,
+			Tags:        job.tags,
+			Owner:       job.owner,
+			Deprecated:  job.deprecated,
+			Hidden:      job.hidden,
+			Disabled:    r.disabled[job.name],
+			Stoppable:   job.isStoppable(),
+			Params:      job.params,
+			Queue:       job.queue,
+		})
+	}
+	r.jobsMu.RUnlock()
+
+	for i := range infos {
+		infos[i].Running = r.runningSignatures(infos[i].Name)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+func (r *Registry) runningSignatures(name string) []string {
+	runningMap := r.runningMap(name)
+	if runningMap == nil {
+		return nil
+	}
+	var signatures []string
+	runningMap.Range(func(key, _ any) bool {
+		if signature, ok := key.(string); ok {
+			signatures = append(signatures, signature)
+		}
+		return true
+	})
+	sort.Strings(signatures)
+	return signatures
+}
+
+// History returns the most recent finished runs, newest first. An empty
+// name returns runs of every job.
+func (r *Registry) History(name string) []base.RunRecord {
+	r.historyMu.Lock()
+	defer r.historyMu.Unlock()
+	records := make([]base.RunRecord, 0, len(r.history))
+	for i := len(r.history) - 1; i >= 0; i-- {
+		if name == "" || r.history[i].Job == name {
+			records = append(records, r.history[i])
+		}
+	}
+	return records
+}
+
+func (r *Registry) record(rec base.RunRecord) {
+	r.historyMu.Lock()
+	defer r.historyMu.Unlock()
+	if len(r.history) == historySize {
+		copy(r.history, r.history[1:])
+		r.history = r.history[:historySize-1]
+	}
+	r.history = append(r.history, rec)
+}
+
 func (r *Registry) ensureRunningMap(name string) {
 	r.runningMu.Lock()
 	defer r.runningMu.Unlock()
@@ -109,16 +358,20 @@ func (r *Registry) runningMap(name string) *sync.Map {
 	return r.running[name]
 }
 
-func (r *Registry) trackStoppable(jobName, signature string, quit chan struct{}) {
-	if signature == "" || quit == nil {
+// trackRun records a run in flight, stoppable or not, until untrackRun.
+func (r *Registry) trackRun(jobName, signature string, run *activeRun) {
+	if signature == "" || run == nil {
 		return
 	}
-	if runningMap := r.runningMap(jobName); runningMap != nil {
-		runningMap.Store(signature, quit)
+	runningMap := r.runningMap(jobName)
+	if runningMap == nil {
+		r.ensureRunningMap(jobName)
+		runningMap = r.runningMap(jobName)
 	}
+	runningMap.Store(signature, run)
 }
 
-func (r *Registry) untrackStoppable(jobName, signature string) {
+func (r *Registry) untrackRun(jobName, signature string) {
 	if signature == "" {
 		return
 	}
@@ -127,30 +380,46 @@ func (r *Registry) untrackStoppable(jobName, signature string) {
 	}
 }
 
+// activeRun finds a tracked run of jobName.
+func (r *Registry) activeRun(jobName, signature string) (*activeRun, bool) {
+	runningMap := r.runningMap(jobName)
+	if runningMap == nil || signature == "" {
+		return nil, false
+	}
+	value, ok := runningMap.Load(signature)
+	if !ok {
+		return nil, false
+	}
+	run, ok := value.(*activeRun)
+	return run, ok
+}
+
 func (r *Registry) stopSpecific(jobName, signature string) bool {
-	if signature == "" {
+	return r.stopWithReason(jobName, signature, "")
+}
+
+func (r *Registry) stopWithReason(jobName, signature, reason string) bool {
+	if !r.closeTracked(jobName, signature, reason) {
 		return false
 	}
-	if runningMap := r.runningMap(jobName); runningMap != nil {
-		if value, ok := runningMap.LoadAndDelete(signature); ok {
-			if quit, ok := value.(chan struct{}); ok {
-				safeCloseQuit(quit)
-			}
-			return true
-		}
-	}
-	return false
+	r.publish(base.Event{Type: base.EventStopRequested, Job: jobName, Signature: signature, Message: reason})
+	return true
+}
+
+// closeTracked closes the quit channel of a tracked run. Only the first
+// caller closes the channel and gets true, so concurrent stops are safe.
+func (r *Registry) closeTracked(jobName, signature, reason string) bool {
+	run, ok := r.activeRun(jobName, signature)
+	return ok && run.requestStop(reason)
 }
 
 func (r *Registry) stopAll(jobName string) bool {
 	if runningMap := r.runningMap(jobName); runningMap != nil {
 		stopped := false
-		runningMap.Range(func(key, value any) bool {
-			runningMap.Delete(key)
-			if quit, ok := value.(chan struct{}); ok {
-				if safeCloseQuit(quit) {
-					stopped = true
-				}
+		runningMap.Range(func(key, _ any) bool {
+			signature, _ := key.(string)
+			if r.stopSpecific(jobName, signature) {
+				stopped = true
 			}
 			return true
 		})
@@ -170,17 +439,44 @@ func WithRegistry(registry *Registry) ServerOption {
 	}
 }
 
+// WithMaxPayloadBytes limits the size of request bodies handed to jobs.
+func WithMaxPayloadBytes(n int64) ServerOption {
+	return func(s *ser) {
+		if n > 0 {
+			s.maxPayloadBytes = n
+		}
+	}
+}
+
+const defaultMaxPayloadBytes = 32 << 20
+
 type ser struct {
-	logger   utils.Logger
-	sockPath string
-	registry *Registry
+	logger          utils.Logger
+	sockPath        string
+	registry        *Registry
+	maxPayloadBytes int64
+	checkpoints     CheckpointStore
+	locker          Locker
+	queues          *queueSet
+	idempotency     *idempotencyCache
+	// prefix is the namespace a mounted registry is served under.
+	prefix   string
+	mountsMu sync.RWMutex
+	mounts   []*mount
 }
 
 func NewServer(logger utils.Logger, sockPath string, opts ...ServerOption) *ser {
 	srv := &ser{
-		logger:   logger,
-		sockPath: sockPath,
-		registry: defaultRegistry,
+		logger:          logger,
+		sockPath:        sockPath,
+		registry:        defaultRegistry,
+		maxPayloadBytes: defaultMaxPayloadBytes,
+		queues:          newQueueSet(),
+		idempotency:     newIdempotencyCache(),
+	}
+	if sockPath != "" {
+		srv.checkpoints = NewFileCheckpointStore(sockPath + ".checkpoints")
+		srv.locker = NewFileLocker(sockPath + ".locks")
 	}
 	for _, opt := range opts {
 		opt(srv)
@@ -194,13 +490,24 @@ func (s *ser) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		if err := recover(); err != nil {
 			stack := utils.Stack(3)
 			s.logger.Errorf("saturn server panic, r: %s, err:%s, stack: %s", r.RequestURI, err, string(stack))
+			s.reply(rw, r, http.StatusInternalServerError, base.Response{Status: base.FAILURE, Message: fmt.Sprintf("panic: %v", err)})
 		}
 	}()
 
-	name := r.URL.Path
-	name = strings.TrimPrefix(name, "/")
+	if strings.HasPrefix(r.URL.Path, base.AdminPathPrefix) {
+		s.serveAdmin(rw, r)
+		return
+	}
+
+	name := jobNameFromPath(r.URL.Path)
+	if s.serveMounted(rw, r, name) {
+		return
+	}
 
 	if job, ok := s.registry.getJob(name); ok {
+		if !s.authorize(rw, r, name) {
+			return
+		}
 		if r.Header.Get(base.StopJobFlag) == "true" {
 			s.stopJob(rw, r, job)
 			return
@@ -209,21 +516,128 @@ func (s *ser) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, _ = rw.Write([]byte("not exist"))
+	s.reply(rw, r, http.StatusNotFound, base.Response{Status: base.NOT_EXIST, Job: name, Message: "job is not registered"})
 	s.logger.Warnf("saturn server job not exist, name:%s", name)
 
 }
 
+// reply writes resp as JSON for clients that accept it and as the bare status
+// text otherwise, which is what clients predating the envelope expect.
+func (s *ser) reply(rw http.ResponseWriter, r *http.Request, code int, resp base.Response) {
+	resp.Job = s.qualify(resp.Job)
+	if strings.Contains(r.Header.Get("Accept"), base.JSONContentType) {
+		s.writeJSON(rw, code, resp)
+		return
+	}
+	rw.WriteHeader(code)
+	_, _ = rw.Write([]byte(resp.Status))
+}
+
 func (s *ser) runJob(rw http.ResponseWriter, r *http.Request, job *notifyJob) {
-	name := job.name
+	query := r.URL.Query()
 	args := map[string]string{}
-	for k, v := range r.URL.Query() {
+	for k, v := range query {
 		if len(v) == 0 {
 			continue
 		}
 		args[k] = v[0]
 	}
+	var payload []byte
+	if r.Body != nil && r.Method != http.MethodGet {
+		var err error
+		payload, err = io.ReadAll(http.MaxBytesReader(rw, r.Body, s.maxPayloadBytes))
+		if err != nil {
+			code := http.StatusBadRequest
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				code = http.StatusRequestEntityTooLarge
+			}
+			s.reply(rw, r, code, base.Response{Status: base.FAILURE, Job: job.name, Message: "read payload: " + err.Error()})
+			s.logger.Errorf("saturn server read payload failure, name:%s, err: %v", job.name, err)
+			return
+		}
+	}
 	signature := r.Header.Get(base.RunSignature)
+	idempotencyKey := r.Header.Get(base.IdempotencyKey)
+	resume := r.Header.Get(base.ResumeRun)
+	if resume != "" {
+		if err := s.checkResume(job, resume); err != nil {
+			s.reply(rw, r, http.StatusConflict, base.Response{Status: base.FAILURE, Job: job.name, Signature: resume, Message: "resume: " + err.Error()})
+			s.logger.Errorf("saturn server job resume failure, name:%s, signature: %s, err: %v", job.name, resume, err)
+			return
+		}
+		signature = resume
+	} else if idempotencyKey == "" {
+		idempotencyKey = signature
+	}
+	caller := callerOf(r)
+	priority := 0
+	if value := r.Header.Get(base.RunPriority); value != "" {
+		var err error
+		if priority, err = strconv.Atoi(value); err != nil {
+			s.reply(rw, r, http.StatusBadRequest, base.Response{Status: base.FAILURE, Job: job.name, Message: "invalid priority " + value})
+			return
+		}
+	}
+	resp := s.execute(invocation{
+		job:         job,
+		args:        args,
+		values:      query,
+		signature:   signature,
+		payload:     payload,
+		contentType: r.Header.Get("Content-Type"),
+		resumed:     resume != "",
+		priority:    priority,
+		cancel:      r.Context().Done(),
+		caller:      &caller,
+		idempotency: idempotencyKey,
+	})
+	code := http.StatusOK
+	switch resp.Status {
+	case base.DISABLED, base.LOCKED:
+		code = http.StatusConflict
+	case base.QUEUE_FULL:
+		code = http.StatusServiceUnavailable
+	case base.RATE_LIMITED:
+		code = http.StatusTooManyRequests
+		rw.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(resp.RetryAfter))))
+	}
+	s.reply(rw, r, code, resp)
+}
+
+// invocation is a single request to run a job, independent of how it arrived.
+type invocation struct {
+	job         *notifyJob
+	args        map[string]string
+	values      url.Values
+	signature   string
+	payload     []byte
+	contentType string
+	// stop, when closed, stops the run as a stop request would.
+	stop <-chan struct{}
+	// stopReason, when set, gives the reason to pass on when stop closes.
+	stopReason func() string
+	// resumed marks a run continuing an earlier one from its checkpoint.
+	resumed bool
+	// priority orders the run in its job's queue.
+	priority int
+	// cancel, when closed, abandons the run if it is still queued.
+	cancel <-chan struct{}
+	// caller made the request, or the workflow a step belongs to; runs
+	// without one are not rate limited.
+	caller *Caller
+	// idempotency is the key under which a repeated request replays the
+	// run's reply instead of running the job again.
+	idempotency string
+}
+
+// execute runs inv on the calling goroutine and describes the outcome. A
+// panicking handler is reported as a failure rather than crashing the server.
+func (s *ser) execute(inv invocation) (resp base.Response) {
+	job := inv.job
+	name := job.name
+	args := inv.args
+	signature := inv.signature
 	if signature == "" {
 		if v, err := uuid.NewUUID(); err == nil {
 			signature = v.String()
@@ -232,32 +646,322 @@ func (s *ser) runJob(rw http.ResponseWriter, r *http.Request, job *notifyJob) {
 	if signature == "" {
 		signature = "cron"
 	}
-	var executeResult bool
+	resp = base.Response{Job: name, Signature: signature}
+	executed := false
+	if inv.idempotency != "" && s.idempotency.enabled() {
+		key := idempotencyKey{job: s.qualify(name), key: inv.idempotency}
+		run, held, err := s.idempotency.acquire(key, inv.cancel)
+		switch {
+		case err != nil:
+			resp.Status, resp.Message = base.INTERRUPT, err.Error()
+			return resp
+		case !held:
+			s.logger.Infof("saturn server job replayed, name:%s, signature: %s, idempotency key: %s", name, run.resp.Signature, inv.idempotency)
+			resp = run.resp
+			resp.Replayed = true
+			return resp
+		}
+		defer func() {
+			s.idempotency.finish(key, run, resp, executed)
+		}()
+	}
+	if reason, disabled := s.registry.disabledReason(name); disabled {
+		resp.Status, resp.Message = base.DISABLED, "job is disabled: "+reason
+		s.logger.Warnf("saturn server job is disabled, name:%s, signature: %s, reason: %s", name, signature, reason)
+		return resp
+	}
+
+	if inv.caller != nil {
+		if wait, ok := job.admit(*inv.caller); !ok {
+			resp.Status, resp.Message, resp.RetryAfter = base.RATE_LIMITED, "rate limited, retry after "+wait.Round(time.Millisecond).String(), wait.Seconds()
+			s.logger.Warnf("saturn server job rate limited, name:%s, signature: %s, caller: %s, retry after: %s", name, signature, inv.caller.rateKey(), wait)
+			return resp
+		}
+	}
+
+	if job.deprecated != "" {
+		s.logger.Warnf("saturn server running deprecated job, name:%s, signature: %s, notice: %s", name, signature, job.deprecated)
+	}
+
+	// every run is tracked for status from when it is accepted, so that runs
+	// waiting in a queue can be listed and stopped; only stoppable ones get a
+	// quit channel
+	var (
+		quit    chan struct{}
+		pause   *pauseState
+		tracked *activeRun
+	)
+	if job.isStoppable() {
+		quit = make(chan struct{})
+		pause = &pauseState{}
+	}
+	tracked = &activeRun{
+		quit:      quit,
+		pause:     pause,
+		pausable:  job.request != nil || job.workflow != nil,
+		startedAt: time.Now(),
+		queued:    job.queue != "",
+		args:      args,
+		ended:     make(chan struct{}),
+		gone:      make(chan struct{}),
+	}
+	if inv.caller != nil {
+		tracked.caller = *inv.caller
+	}
+	s.registry.trackRun(name, signature, tracked)
+	defer func() {
+		s.registry.untrackRun(name, signature)
+		close(tracked.ended)
+	}()
+	if job.isStoppable() {
+		if inv.stop != nil {
+			finished := make(chan struct{})
+			defer close(finished)
+			go func() {
+				select {
+				case <-inv.stop:
+					reason := ""
+					if inv.stopReason != nil {
+						reason = inv.stopReason()
+					}
+					s.registry.stopWithReason(name, signature, reason)
+				case <-finished:
+				}
+			}()
+		}
+		if job.contextual != nil && inv.cancel != nil && inv.stop == nil {
+			finished := make(chan struct{})
+			defer close(finished)
+			go func() {
+				select {
+				case <-inv.cancel:
+					s.registry.stopWithReason(name, signature, "caller went away before the run finished")
+				case <-finished:
+				}
+			}()
+		}
+	}
+
+	if job.queue != "" {
+		queue := s.queues.get(job.queue)
+		run := base.QueuedRun{Job: s.qualify(name), Signature: signature, Priority: inv.priority, EnqueuedAt: time.Now()}
+		err := queue.acquire(run, inv.cancel, quit, func(position int) {
+			s.registry.publish(base.Event{Type: base.EventQueued, Job: name, Signature: signature, Message: fmt.Sprintf("position %d in queue %s", position, job.queue)})
+		})
+		switch {
+		case errors.Is(err, errQueueFull):
+			resp.Status, resp.Message = base.QUEUE_FULL, "queue "+job.queue+" is full"
+			s.logger.Warnf("saturn server job rejected, queue is full, name:%s, signature: %s, queue: %s", name, signature, job.queue)
+			return resp
+		case err != nil && quit != nil && isClosed(quit):
+			resp.Status, resp.Message = base.INTERRUPT, "job was stopped before it started"
+			if resp.StopReason = tracked.stopReason(); resp.StopReason != "" {
+				resp.Message += ": " + resp.StopReason
+			}
+			s.logger.Warnf("saturn server queued job was stopped, name:%s, signature: %s, queue: %s", name, signature, job.queue)
+			return resp
+		case err != nil:
+			resp.Status, resp.Message = base.INTERRUPT, err.Error()
+			s.logger.Warnf("saturn server queued job abandoned, name:%s, signature: %s, queue: %s", name, signature, job.queue)
+			return resp
+		}
+		defer queue.release()
+	}
+
+	// a run skipped for the lock never started, so it is neither recorded nor
+	// kept for idempotent retries, which try for the lock again
+	lockLost := make(chan error, 1)
+	var releaseLock func()
+	if job.lockTTL > 0 {
+		release, locked, err := s.lockRun(job, signature, func(err error) {
+			lockLost <- err
+			s.registry.closeTracked(name, signature, "lost the job's lock: "+err.Error())
+		})
+		switch {
+		case err != nil:
+			s.logger.Errorf("saturn server job lock failure, name:%s, signature: %s, err: %v", name, signature, err)
+			resp.Status, resp.Message = base.FAILURE, "lock: "+err.Error()
+		case !locked:
+			s.logger.Warnf("saturn server job skipped, lock is held elsewhere, name:%s, signature: %s", name, signature)
+			resp.Status, resp.Message = base.LOCKED, "another run holds the job's lock"
+		}
+		if resp.Status != "" {
+			s.registry.publish(base.Event{Type: eventTypeFor(resp.Status), Job: name, Signature: signature, Message: resp.Message})
+			return resp
+		}
+		releaseLock = release
+		defer func() {
+			if releaseLock != nil {
+				releaseLock()
+			}
+		}()
+	}
+
+	executed = true
+	startedAt := time.Now()
+	tracked.start(startedAt)
+	var jobReq *JobRequest
+	defer func() {
+		if jobReq != nil {
+			jobReq.fillResponse(&resp)
+			if resp.Status == base.SUCCESS && jobReq.checkpoints != nil {
+				if err := jobReq.checkpoints.Delete(name, signature); err != nil {
+					s.logger.Warnf("saturn server failed to delete checkpoint, name:%s, signature: %s, err: %v", name, signature, err)
+				}
+			}
+		}
+		s.registry.record(base.RunRecord{Response: resp, Args: args, StartedAt: startedAt, FinishedAt: time.Now()})
+		s.registry.publish(base.Event{Type: eventTypeFor(resp.Status), Job: name, Signature: signature, Message: resp.Message})
+	}()
+	defer func() {
+		if err := recover(); err != nil {
+			stack := utils.Stack(3)
+			if p, ok := err.(handlerPanic); ok {
+				err, stack = p.value, p.stack
+			}
+			s.logger.Errorf("saturn server job panic, name:%s, signature: %s, err:%s, stack: %s", name, signature, err, string(stack))
+			resp.Status, resp.Message = base.FAILURE, fmt.Sprintf("panic: %v", err)
+		}
+	}()
+
+	// the timeout counts from the start, not from when the run was queued
+	var timedOut atomic.Bool
+	if quit != nil && job.timeout > 0 {
+		timer := time.AfterFunc(job.timeout, func() {
+			if s.registry.closeTracked(name, signature, fmt.Sprintf("job exceeded its %s timeout", job.timeout)) {
+				timedOut.Store(true)
+			}
+		})
+		defer timer.Stop()
+	}
+	started := base.Event{Type: base.EventStarted, Job: name, Signature: signature}
+	if inv.resumed {
+		started.Message = "resumed from checkpoint"
+	}
+	s.registry.publish(started)
+
 	switch {
-	case job.handler != nil:
-		executeResult = job.handler(args, signature)
-	case job.stoppable != nil:
-		quit := make(chan struct{})
-		s.registry.trackStoppable(name, signature, quit)
-		defer s.registry.untrackStoppable(name, signature)
-		executeResult = job.stoppable(args, signature, quit)
-		if isClosed(quit) {
-			_, _ = rw.Write([]byte(base.INTERRUPT))
-			s.logger.Warnf("saturn server job was interrupted, name:%s, args: %s, signature: %s", name, args, signature)
-			return
+	case job.request != nil:
+		jobReq = &JobRequest{
+			Name:        name,
+			Signature:   signature,
+			Args:        args,
+			Values:      inv.values,
+			Payload:     inv.payload,
+			ContentType: inv.contentType,
+			Resumed:     inv.resumed,
+			quit:        quit,
+			pause:       pause,
+			run:         tracked,
+			publish:     s.registry.publish,
+			checkpoints: s.checkpoints,
 		}
-	default:
+	case job.workflow != nil:
+		jobReq = &JobRequest{
+			Name:      name,
+			Signature: signature,
+			Args:      args,
+			Values:    inv.values,
+			quit:      quit,
+			pause:     pause,
+			run:       tracked,
+			publish:   s.registry.publish,
+			caller:    inv.caller,
+		}
+	case job.handler == nil && job.stoppable == nil && job.contextual == nil:
 		s.logger.Errorf("saturn server job handler missing, name:%s", name)
-		_, _ = rw.Write([]byte(base.FAILURE))
-		return
+		resp.Status, resp.Message = base.FAILURE, "job handler missing"
+		return resp
+	}
+	req := jobReq
+	handle := func() bool {
+		switch {
+		case job.handler != nil:
+			return job.handler(args, signature)
+		case job.stoppable != nil:
+			return job.stoppable(args, signature, quit)
+		case job.contextual != nil:
+			ctx, cancel := context.WithCancelCause(context.Background())
+			defer cancel(nil)
+			go func() {
+				select {
+				case <-quit:
+					cancel(&StopError{Reason: tracked.stopReason()})
+				case <-ctx.Done():
+				}
+			}()
+			return job.contextual(ctx, args, signature)
+		case job.request != nil:
+			return job.request(req)
+		default:
+			return s.runWorkflow(job.workflow, req)
+		}
+	}
+
+	executeResult := false
+	if quit == nil {
+		// plain handlers cannot be stopped, so there is nothing to wait out
+		executeResult = handle()
+	} else if result, returned := awaitHandler(tracked, handle, releaseLock); returned {
+		executeResult = result
+	} else {
+		// the handler still owns its request, and keeps the job's lock until
+		// it returns so that no other run can start beside it
+		jobReq = nil
+		releaseLock = nil
+		resp.Status, resp.Message = base.ABANDONED, "run was abandoned by a forced stop before its handler returned"
+		resp.StopReason = tracked.stopReason()
+		s.logger.Warnf("saturn server job was abandoned, name:%s, args: %s, signature: %s", name, args, signature)
+		return resp
+	}
+	select {
+	case err := <-lockLost:
+		// a stoppable run was asked to stop; a plain one ran on without the
+		// lock, so another run may have overlapped it
+		resp.Status, resp.Message = base.FAILURE, "job lost its lock while running: "+err.Error()
+		s.logger.Errorf("saturn server job lost its lock, name:%s, args: %s, signature: %s, err: %v", name, args, signature, err)
+		return resp
+	default:
+	}
+	if timedOut.Load() {
+		resp.Status, resp.Message = base.TIMEOUT, fmt.Sprintf("job exceeded its %s timeout", job.timeout)
+		s.logger.Warnf("saturn server job timed out, name:%s, args: %s, signature: %s", name, args, signature)
+		return resp
+	}
+	if quit != nil && isClosed(quit) {
+		resp.Status, resp.Message = base.INTERRUPT, "job was stopped"
+		if resp.StopReason = tracked.stopReason(); resp.StopReason != "" {
+			resp.Message += ": " + resp.StopReason
+		}
+		s.logger.Warnf("saturn server job was interrupted, name:%s, args: %s, signature: %s", name, args, signature)
+		return resp
 	}
 	if executeResult {
-		_, _ = rw.Write([]byte(base.SUCCESS))
+		resp.Status = base.SUCCESS
 		s.logger.Infof("saturn server job run success, name:%s, args: %s, signature: %s", name, args, signature)
 	} else {
-		_, _ = rw.Write([]byte(base.FAILURE))
+		resp.Status, resp.Message = base.FAILURE, "job handler reported failure"
 		s.logger.Errorf("saturn server job run fail, name:%s, args: %s, signature: %s", name, args, signature)
 	}
+	return resp
+}
+
+// eventTypeFor maps the final status of a run to the event announcing it.
+func eventTypeFor(status string) string {
+	switch status {
+	case base.SUCCESS:
+		return base.EventSucceeded
+	case base.INTERRUPT:
+		return base.EventInterrupted
+	case base.TIMEOUT:
+		return base.EventTimedOut
+	case base.LOCKED:
+		return base.EventSkipped
+	case base.ABANDONED:
+		return base.EventAbandoned
+	default:
+		return base.EventFailed
+	}
 }
 
 func isClosed(ch <-chan struct{}) bool {
@@ -269,41 +973,6 @@ func isClosed(ch <-chan struct{}) bool {
 	}
 }
 
-func (s *ser) stopJob(rw http.ResponseWriter, r *http.Request, job *notifyJob) {
-	jobName := ""
-	if job != nil {
-		jobName = job.name
-	}
-	if job == nil || !job.isStoppable() {
-		_, _ = rw.Write([]byte(base.FAILURE))
-		s.logger.Errorf("saturn server job stop failure, job is not stoppable, name:%s", jobName)
-		return
-	}
-	name := job.name
-	args := map[string]string{}
-	for k, v := range r.URL.Query() {
-		if len(v) == 0 {
-			continue
-		}
-		args[k] = v[0]
-	}
-	var executeResult bool
-	signature := r.Header.Get(base.StopSignature)
-	if signature != "" {
-		executeResult = s.registry.stopSpecific(name, signature)
-	} else {
-		executeResult = s.registry.stopAll(name)
-	}
-
-	if executeResult {
-		_, _ = rw.Write([]byte(base.SUCCESS))
-		s.logger.Infof("saturn server job stop success, name:%s, args: %s, signature: %s", name, args, signature)
-	} else {
-		_, _ = rw.Write([]byte(base.FAILURE))
-		s.logger.Errorf("saturn server job stop failure, name:%s, args: %s, signature: %s", name, args, signature)
-	}
-}
-
 func safeCloseQuit(quit chan struct{}) bool {
 	if quit == nil {
 		return false
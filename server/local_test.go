@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+	"github.com/Kingson4Wu/saturncli/utils"
+)
+
+func TestServeLocal(t *testing.T) {
+	registry := NewRegistry()
+	started := make(chan struct{})
+	stopped := make(chan struct{})
+	app := registry.Group("app")
+	if err := app.AddJob("hello", func(args map[string]string, _ string) bool {
+		return args["ok"] == "true"
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	if err := registry.AddContextJob("slow", func(ctx context.Context, _ map[string]string, _ string) bool {
+		close(started)
+		<-ctx.Done()
+		close(stopped)
+		return false
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	// local callers are this very process, known wherever it has a uid
+	if caller := processCaller(); caller.Known {
+		app.SetACL(AllowUIDs(caller.UID))
+	}
+
+	local := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry)).ServeLocal()
+	httpc := &http.Client{Transport: &http.Transport{DialContext: local.DialContext}}
+	get := func(ctx context.Context, path string) (base.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://local"+path, nil)
+		if err != nil {
+			t.Fatalf("build request: %v", err)
+		}
+		req.Header.Set("Accept", base.JSONContentType)
+		response, err := httpc.Do(req)
+		if err != nil {
+			return base.Response{}, err
+		}
+		defer response.Body.Close()
+		var resp base.Response
+		if err := json.NewDecoder(response.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode reply: %v", err)
+		}
+		return resp, nil
+	}
+
+	if resp, err := get(context.Background(), "/app/hello?ok=true"); err != nil || resp.Status != base.SUCCESS {
+		t.Fatalf("expected the run to succeed in memory: %+v, %v", resp, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	if _, err := get(ctx, "/slow"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the request to be cancelled, got %v", err)
+	}
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("the run was not stopped when its caller went away")
+	}
+
+	if err := local.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if _, err := local.DialContext(context.Background(), "", ""); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("dialing a closed server should fail, got %v", err)
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"time"
+)
+
+const defaultLockTTL = time.Minute
+
+// Locker grants the locks that keep a job registered WithLock from running
+// more than once at a time, across every server sharing the Locker.
+// Implementations backed by an external store let replicas on several hosts
+// coordinate; they must be safe for concurrent use.
+type Locker interface {
+	// Acquire takes key for ttl. It returns ok false, without error, when
+	// another holder has the key.
+	Acquire(key string, ttl time.Duration) (lock Lock, ok bool, err error)
+}
+
+// Lock is a lock held by a run. The server refreshes it every third of its
+// TTL while the handler runs and releases it when the run ends. When a
+// refresh fails the lock is taken as lost: a stoppable run is stopped, and
+// any run ends with status base.FAILURE.
+type Lock interface {
+	Refresh(ttl time.Duration) error
+	Release() error
+}
+
+// WithLocker sets the Locker consulted before running jobs registered
+// WithLock. By default a server with a socket path uses a FileLocker in the
+// directory sockPath + ".locks", which covers processes of a single host.
+func WithLocker(locker Locker) ServerOption {
+	return func(s *ser) {
+		s.locker = locker
+	}
+}
+
+// WithLock makes the job take a lock before each run, so that only one run
+// holds key at a time; an empty key uses the job name. Runs that find the lock
+// taken end with status base.LOCKED without calling the handler. A ttl of
+// zero means one minute.
+func WithLock(key string, ttl time.Duration) JobOption {
+	return func(j *notifyJob) {
+		if ttl <= 0 {
+			ttl = defaultLockTTL
+		}
+		j.lockKey, j.lockTTL = key, ttl
+	}
+}
+
+// FileLocker keeps a lock file per key in a directory. On Unix the files
+// carry advisory locks, which the operating system releases if the process
+// dies, so TTLs are ignored; on Windows a lock file that was not refreshed
+// within its TTL is taken over.
+type FileLocker struct {
+	dir string
+}
+
+// NewFileLocker returns a locker keeping its lock files in dir, created on
+// first use.
+func NewFileLocker(dir string) *FileLocker {
+	return &FileLocker{dir: dir}
+}
+
+func (f *FileLocker) path(key string) (string, error) {
+	if key == "" || key == "." || key == ".." {
+		return "", fmt.Errorf("invalid lock key %q", key)
+	}
+	return filepath.Join(f.dir, url.PathEscape(key)+".lock"), nil
+}
+
+// lockRun takes the lock of job for a run. It returns a release function, or
+// false when another holder has the lock. lost is called, and refreshing
+// ends, when the lock cannot be refreshed.
+func (s *ser) lockRun(job *notifyJob, signature string, lost func(error)) (release func(), ok bool, err error) {
+	if s.locker == nil {
+		return nil, false, fmt.Errorf("job %s requires a lock but the server has no Locker", job.name)
+	}
+	key := job.lockKey
+	if key == "" {
+		key = s.qualify(job.name)
+	}
+	lock, ok, err := s.locker.Acquire(key, job.lockTTL)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(job.lockTTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := lock.Refresh(job.lockTTL); err != nil {
+					s.logger.Errorf("saturn server failed to refresh lock, name:%s, signature: %s, key: %s, err: %v", job.name, signature, key, err)
+					lost(err)
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		if err := lock.Release(); err != nil {
+			s.logger.Warnf("saturn server failed to release lock, name:%s, signature: %s, key: %s, err: %v", job.name, signature, key, err)
+		}
+	}, true, nil
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+	"github.com/Kingson4Wu/saturncli/utils"
+)
+
+func TestFileLocker(t *testing.T) {
+	locker := NewFileLocker(t.TempDir())
+	first, ok, err := locker.Acquire("billing.reindex", time.Minute)
+	if err != nil || !ok {
+		t.Fatalf("first acquire should succeed, got %v %v", ok, err)
+	}
+	if _, ok, err := locker.Acquire("billing.reindex", time.Minute); err != nil || ok {
+		t.Fatalf("second acquire should find the lock taken, got %v %v", ok, err)
+	}
+	if _, ok, err := locker.Acquire("other", time.Minute); err != nil || !ok {
+		t.Fatalf("other keys should be independent, got %v %v", ok, err)
+	}
+	if err := first.Release(); err != nil {
+		t.Fatalf("release failed: %v", err)
+	}
+	if _, ok, err := locker.Acquire("billing.reindex", time.Minute); err != nil || !ok {
+		t.Fatalf("acquire after release should succeed, got %v %v", ok, err)
+	}
+	if _, _, err := locker.Acquire("..", time.Minute); err == nil {
+		t.Fatal("invalid keys should be rejected")
+	}
+}
+
+func TestLockedJobRunsOnce(t *testing.T) {
+	registry := NewRegistry()
+	started, release := make(chan struct{}), make(chan struct{})
+	if err := registry.AddJob("report", func(map[string]string, string) bool {
+		started <- struct{}{}
+		<-release
+		return true
+	}, WithLock("", 0)); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry), WithLocker(NewFileLocker(t.TempDir())))
+
+	done := serveAsync(srv, httptest.NewRequest(http.MethodGet, "/report", nil))
+	<-started
+	events, cancel := registry.SubscribeChan()
+	defer cancel()
+	retry := func() *http.Request {
+		req := httptest.NewRequest(http.MethodGet, "/report", nil)
+		req.Header.Set(base.RunSignature, "retry")
+		return req
+	}
+	if resp := serveJSON(t, srv, retry()); resp.Status != base.LOCKED {
+		t.Fatalf("expected the second run to be skipped, got %+v", resp)
+	}
+	if event := <-events; event.Type != base.EventSkipped {
+		t.Fatalf("expected a skipped event, got %+v", event)
+	}
+	close(release)
+	if resp := decodeReply(t, <-done); resp.Status != base.SUCCESS {
+		t.Fatalf("the first run should succeed, got %+v", resp)
+	}
+	if history := registry.History("report"); len(history) != 1 || history[0].Status != base.SUCCESS {
+		t.Fatalf("the skipped run should not be recorded as a run, got %+v", history)
+	}
+
+	go func() { <-started }()
+	if resp := serveJSON(t, srv, retry()); resp.Status != base.SUCCESS || resp.Replayed {
+		t.Fatalf("a retry of the skipped run should take the released lock and run, got %+v", resp)
+	}
+}
+
+type losingLocker struct{}
+
+func (losingLocker) Acquire(string, time.Duration) (Lock, bool, error) {
+	return losingLocker{}, true, nil
+}
+
+func (losingLocker) Refresh(time.Duration) error {
+	return errors.New("lease expired")
+}
+
+func (losingLocker) Release() error {
+	return nil
+}
+
+func TestLostLockEndsRun(t *testing.T) {
+	registry := NewRegistry()
+	if err := registry.AddStoppableJob("stoppable", func(_ map[string]string, _ string, quit chan struct{}) bool {
+		<-quit
+		return true
+	}, WithLock("", 30*time.Millisecond)); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	if err := registry.AddJob("plain", func(map[string]string, string) bool {
+		time.Sleep(100 * time.Millisecond)
+		return true
+	}, WithLock("", 30*time.Millisecond)); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry), WithLocker(losingLocker{}))
+	for _, job := range []string{"stoppable", "plain"} {
+		resp := serveJSON(t, srv, httptest.NewRequest(http.MethodGet, "/"+job, nil))
+		if resp.Status != base.FAILURE || resp.Message != "job lost its lock while running: lease expired" {
+			t.Fatalf("%s: expected the lost lock to fail the run, got %+v", job, resp)
+		}
+	}
+}
+
+type countingLocker struct {
+	mu                 sync.Mutex
+	refreshed, release int
+}
+
+func (l *countingLocker) Acquire(string, time.Duration) (Lock, bool, error) {
+	return l, true, nil
+}
+
+func (l *countingLocker) Refresh(time.Duration) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refreshed++
+	return nil
+}
+
+func (l *countingLocker) Release() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.release++
+	return nil
+}
+
+func TestLockRefreshedWhileRunning(t *testing.T) {
+	registry := NewRegistry()
+	if err := registry.AddJob("slow", func(map[string]string, string) bool {
+		time.Sleep(100 * time.Millisecond)
+		return true
+	}, WithLock("shared", 30*time.Millisecond)); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	locker := &countingLocker{}
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry), WithLocker(locker))
+	if resp := serveJSON(t, srv, httptest.NewRequest(http.MethodGet, "/slow", nil)); resp.Status != base.SUCCESS {
+		t.Fatalf("run failed: %+v", resp)
+	}
+	locker.mu.Lock()
+	defer locker.mu.Unlock()
+	if locker.refreshed == 0 || locker.release != 1 {
+		t.Fatalf("expected refreshes and one release, got %d refreshes and %d releases", locker.refreshed, locker.release)
+	}
+
+	noLocker := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry))
+	if resp := serveJSON(t, noLocker, httptest.NewRequest(http.MethodGet, "/slow", nil)); resp.Status != base.FAILURE {
+		t.Fatalf("a locked job should fail without a Locker, got %+v", resp)
+	}
+}
+
+func TestAbandonedRunKeepsLock(t *testing.T) {
+	registry := NewRegistry()
+	started, exit := make(chan struct{}, 2), make(chan struct{})
+	if err := registry.AddStoppableJob("report", func(_ map[string]string, _ string, _ chan struct{}) bool {
+		started <- struct{}{}
+		<-exit
+		return true
+	}, WithLock("", 0)); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry), WithLocker(NewFileLocker(t.TempDir())))
+
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/report", nil))
+		done <- rec
+	}()
+	<-started
+	stop := httptest.NewRequest(http.MethodGet, "/report", nil)
+	stop.Header.Set(base.StopJobFlag, "true")
+	stop.Header.Set(base.StopWait, "10ms")
+	stop.Header.Set(base.StopForce, "true")
+	if resp := serveJSON(t, srv, stop); resp.State != base.RunAbandoned {
+		t.Fatalf("the forced stop should abandon the run, got %+v", resp)
+	}
+	<-done
+	if resp := serveJSON(t, srv, httptest.NewRequest(http.MethodGet, "/report", nil)); resp.Status != base.LOCKED {
+		t.Fatalf("the abandoned handler should still hold the lock, got %+v", resp)
+	}
+
+	close(exit)
+	deadline := time.Now().Add(time.Second)
+	for {
+		resp := serveJSON(t, srv, httptest.NewRequest(http.MethodGet, "/report", nil))
+		if resp.Status == base.SUCCESS {
+			break
+		}
+		if resp.Status != base.LOCKED || time.Now().After(deadline) {
+			t.Fatalf("the lock should be released once the handler returns, got %+v", resp)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,50 @@
+//go:build !windows
+
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// Acquire implements Locker.
+func (f *FileLocker) Acquire(key string, _ time.Duration) (Lock, bool, error) {
+	path, err := f.path(key)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, false, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		file.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return &fileLock{file: file}, true, nil
+}
+
+type fileLock struct {
+	file *os.File
+}
+
+func (l *fileLock) Refresh(time.Duration) error {
+	return nil
+}
+
+func (l *fileLock) Release() error {
+	if err := syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN); err != nil {
+		l.file.Close()
+		return err
+	}
+	return l.file.Close()
+}
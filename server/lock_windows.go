@@ -0,0 +1,57 @@
+//go:build windows
+
+package server
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Acquire implements Locker. Without advisory locks the lock file is created
+// exclusively and taken over once it has not been refreshed for ttl.
+func (f *FileLocker) Acquire(key string, ttl time.Duration) (Lock, bool, error) {
+	path, err := f.path(key)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, false, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if errors.Is(err, os.ErrExist) {
+		info, statErr := os.Stat(path)
+		if statErr != nil || time.Since(info.ModTime()) < ttl {
+			return nil, false, nil
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, false, nil
+		}
+		file, err = os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if errors.Is(err, os.ErrExist) {
+			return nil, false, nil
+		}
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	file.Close()
+	return &fileLock{path: path}, true, nil
+}
+
+type fileLock struct {
+	path string
+}
+
+func (l *fileLock) Refresh(time.Duration) error {
+	now := time.Now()
+	return os.Chtimes(l.path, now, now)
+}
+
+func (l *fileLock) Release() error {
+	if err := os.Remove(l.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/Kingson4Wu/saturncli/base"
+)
+
+// Middleware wraps the handler of a mount, for example to log or
+// authenticate its requests. It sees requests with their original path.
+type Middleware func(http.Handler) http.Handler
+
+// mount serves the jobs of another registry under a namespace of the server.
+type mount struct {
+	prefix  string
+	server  *ser
+	handler http.Handler
+}
+
+// Mount serves the jobs of registry under prefix, so that its job "reindex"
+// runs as prefix.reindex. The registry keeps its own history, runs and
+// checkpoints; its events are republished on the server's registry with
+// qualified names. Mount fails when prefix overlaps another mount or a job
+// of the server's registry, and the server's registry then refuses new jobs
+// under prefix. Middleware applies to every request for the mounted jobs,
+// the first given being the outermost.
+func (s *ser) Mount(prefix string, registry *Registry, middleware ...Middleware) error {
+	if err := validateJobName(prefix); err != nil {
+		return fmt.Errorf("mount prefix: %w", err)
+	}
+	if registry == nil {
+		return errors.New("registry is nil")
+	}
+	if registry == s.registry {
+		return errors.New("registry is already served at the root")
+	}
+
+	s.mountsMu.Lock()
+	defer s.mountsMu.Unlock()
+	for _, m := range s.mounts {
+		if m.server.registry == registry {
+			return fmt.Errorf("registry is already mounted at %s", m.prefix)
+		}
+		if namespaceOverlaps(m.prefix, prefix) {
+			return fmt.Errorf("mount prefix %s collides with mount %s", prefix, m.prefix)
+		}
+	}
+	if err := s.registry.reserveNamespace(prefix); err != nil {
+		return err
+	}
+
+	sub := &ser{
+		logger:          s.logger,
+		prefix:          prefix,
+		registry:        registry,
+		maxPayloadBytes: s.maxPayloadBytes,
+		locker:          s.locker,
+		queues:          s.queues,
+		idempotency:     s.idempotency,
+	}
+	if s.checkpoints != nil {
+		sub.checkpoints = prefixedCheckpoints{CheckpointStore: s.checkpoints, prefix: prefix}
+	}
+	m := &mount{prefix: prefix, server: sub}
+	var handler http.Handler = http.HandlerFunc(m.dispatch)
+	for i := len(middleware) - 1; i >= 0; i-- {
+		if middleware[i] != nil {
+			handler = middleware[i](handler)
+		}
+	}
+	m.handler = handler
+	registry.Subscribe(func(event base.Event) {
+		event.Job = sub.qualify(event.Job)
+		s.registry.publish(event)
+	})
+	s.mounts = append(s.mounts, m)
+	return nil
+}
+
+// namespaceOverlaps reports whether a and b are the same namespace or one
+// contains the other.
+func namespaceOverlaps(a, b string) bool {
+	return a == b ||
+		strings.HasPrefix(a, b+base.NamespaceSeparator) ||
+		strings.HasPrefix(b, a+base.NamespaceSeparator)
+}
+
+// reserveNamespace makes putJob refuse names under prefix, failing when a
+// registered job already uses it.
+func (r *Registry) reserveNamespace(prefix string) error {
+	r.jobsMu.Lock()
+	defer r.jobsMu.Unlock()
+	for name := range r.jobs {
+		if namespaceOverlaps(name, prefix) {
+			return fmt.Errorf("mount prefix %s collides with job %s", prefix, name)
+		}
+	}
+	r.reserved = append(r.reserved, prefix)
+	return nil
+}
+
+// reservedFor names the mount prefix that name falls under, if any. Callers
+// hold jobsMu.
+func (r *Registry) reservedFor(name string) (string, bool) {
+	for _, prefix := range r.reserved {
+		if namespaceOverlaps(name, prefix) {
+			return prefix, true
+		}
+	}
+	return "", false
+}
+
+// mountFor finds the mount serving the job name.
+func (s *ser) mountFor(name string) (*mount, bool) {
+	s.mountsMu.RLock()
+	defer s.mountsMu.RUnlock()
+	for _, m := range s.mounts {
+		if strings.HasPrefix(name, m.prefix+base.NamespaceSeparator) {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+func (s *ser) mountList() []*mount {
+	s.mountsMu.RLock()
+	defer s.mountsMu.RUnlock()
+	return append([]*mount(nil), s.mounts...)
+}
+
+// local strips the mount prefix from a qualified job name.
+func (m *mount) local(name string) string {
+	return strings.TrimPrefix(name, m.prefix+base.NamespaceSeparator)
+}
+
+// dispatch hands a request to the mounted registry's server, with the job
+// named in the path or the job query parameter made local to it.
+func (m *mount) dispatch(rw http.ResponseWriter, r *http.Request) {
+	r = r.Clone(r.Context())
+	if strings.HasPrefix(r.URL.Path, base.AdminPathPrefix) {
+		query := r.URL.Query()
+		if job := query.Get("job"); job != "" {
+			query.Set("job", m.local(job))
+			r.URL.RawQuery = query.Encode()
+		}
+	} else {
+		r.URL.Path = "/" + m.local(jobNameFromPath(r.URL.Path))
+		r.URL.RawPath = ""
+	}
+	m.server.ServeHTTP(rw, r)
+}
+
+// qualify returns the name a job of the server's registry is known by to
+// clients: unchanged at the root, prefixed on a mount.
+func (s *ser) qualify(name string) string {
+	if s.prefix == "" || name == "" {
+		return name
+	}
+	return s.prefix + base.NamespaceSeparator + name
+}
+
+// serveMounted hands r to the mount serving job, if the caller may use it,
+// and reports whether there was one.
+func (s *ser) serveMounted(rw http.ResponseWriter, r *http.Request, job string) bool {
+	m, ok := s.mountFor(job)
+	if !ok {
+		return false
+	}
+	if s.authorize(rw, r, job) {
+		m.handler.ServeHTTP(rw, r)
+	}
+	return true
+}
+
+// serveMountedBatch routes a batch request for a mounted job, rewriting its
+// body to name the job locally, and reports whether it did.
+func (s *ser) serveMountedBatch(rw http.ResponseWriter, r *http.Request) bool {
+	if r.Method != http.MethodPost || r.Body == nil || len(s.mountList()) == 0 {
+		return false
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(rw, r.Body, maxBatchBodyBytes))
+	if err != nil {
+		s.writeJSON(rw, http.StatusBadRequest, base.Response{Status: base.FAILURE, Message: "invalid batch request: " + err.Error()})
+		return true
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	var req base.BatchRequest
+	if json.Unmarshal(body, &req) != nil {
+		return false
+	}
+	m, ok := s.mountFor(req.Job)
+	if !ok {
+		return false
+	}
+	req.Job = m.local(req.Job)
+	if body, err = json.Marshal(req); err != nil {
+		return false
+	}
+	r.Body, r.ContentLength = io.NopCloser(bytes.NewReader(body)), int64(len(body))
+	return s.serveMounted(rw, r, m.prefix+base.NamespaceSeparator+req.Job)
+}
+
+// jobInfos lists the jobs of the server's registry and of every mount,
+// sorted by qualified name. See Registry.jobInfos for the filters. Runs in
+// flight are left out for jobs the caller may not use.
+func (s *ser) jobInfos(pattern, tag string, includeHidden bool, caller Caller) []base.JobInfo {
+	infos := []base.JobInfo{}
+	for _, info := range s.registry.jobInfos(tag, includeHidden) {
+		if !s.registry.allows(info.Name, caller) {
+			info.Running = nil
+		}
+		if info.Name = s.qualify(info.Name); matchJobName(pattern, info.Name) {
+			infos = append(infos, info)
+		}
+	}
+	for _, m := range s.mountList() {
+		for _, info := range m.server.jobInfos(pattern, tag, includeHidden, caller) {
+			if !s.registry.allows(info.Name, caller) {
+				info.Running = nil
+			}
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
+
+// history is Registry.History across the server's registry and its mounts,
+// newest first, leaving out runs of jobs the caller may not use.
+func (s *ser) history(job string, caller Caller) []base.RunRecord {
+	records := []base.RunRecord{}
+	for _, record := range s.registry.History(job) {
+		if s.registry.allows(record.Job, caller) {
+			record.Job = s.qualify(record.Job)
+			records = append(records, record)
+		}
+	}
+	mounts := s.mountList()
+	if job != "" || len(mounts) == 0 {
+		return records
+	}
+	for _, m := range mounts {
+		for _, record := range m.server.history("", caller) {
+			if s.registry.allows(record.Job, caller) {
+				records = append(records, record)
+			}
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool { return records[i].FinishedAt.After(records[j].FinishedAt) })
+	return records
+}
+
+// runs is Registry.Runs across the server's registry and its mounts, oldest
+// first, leaving out runs of jobs the caller may not use.
+func (s *ser) runs(job string, caller Caller) []base.RunInfo {
+	runs := []base.RunInfo{}
+	for _, run := range s.registry.Runs(job) {
+		if s.registry.allows(run.Job, caller) {
+			run.Job = s.qualify(run.Job)
+			runs = append(runs, run)
+		}
+	}
+	mounts := s.mountList()
+	if job != "" || len(mounts) == 0 {
+		return runs
+	}
+	for _, m := range mounts {
+		for _, run := range m.server.runs("", caller) {
+			if s.registry.allows(run.Job, caller) {
+				runs = append(runs, run)
+			}
+		}
+	}
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].StartedAt.Before(runs[j].StartedAt) })
+	return runs
+}
+
+// prefixedCheckpoints keeps a mounted registry's checkpoints in the server's
+// store under qualified job names, so mounts cannot overwrite each other's.
+type prefixedCheckpoints struct {
+	CheckpointStore
+	prefix string
+}
+
+func (p prefixedCheckpoints) Save(job, signature string, cursor []byte) error {
+	return p.CheckpointStore.Save(p.prefix+base.NamespaceSeparator+job, signature, cursor)
+}
+
+func (p prefixedCheckpoints) Load(job, signature string) ([]byte, bool, error) {
+	return p.CheckpointStore.Load(p.prefix+base.NamespaceSeparator+job, signature)
+}
+
+func (p prefixedCheckpoints) Delete(job, signature string) error {
+	return p.CheckpointStore.Delete(p.prefix+base.NamespaceSeparator+job, signature)
+}
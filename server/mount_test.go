@@ -0,0 +1,201 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+	"github.com/Kingson4Wu/saturncli/utils"
+)
+
+func TestMountCollisions(t *testing.T) {
+	ok := func(map[string]string, string) bool { return true }
+	root := NewRegistry()
+	if err := root.AddJob("ops.cleanup", ok); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(root))
+	billing := NewRegistry()
+	if err := srv.Mount("billing", billing); err != nil {
+		t.Fatalf("mount failed: %v", err)
+	}
+
+	for _, c := range []struct {
+		prefix   string
+		registry *Registry
+	}{
+		{"billing", NewRegistry()},
+		{"billing.invoices", NewRegistry()},
+		{"ops", NewRegistry()},
+		{"search", billing},
+		{"search", root},
+		{"bad/prefix", NewRegistry()},
+	} {
+		if err := srv.Mount(c.prefix, c.registry); err == nil {
+			t.Fatalf("mounting at %s should fail", c.prefix)
+		}
+	}
+	if err := root.AddJob("billing.reindex", ok); err == nil {
+		t.Fatal("the server registry should refuse jobs under a mount")
+	}
+	if err := root.AddJob("billingreport", ok); err != nil {
+		t.Fatalf("a name merely starting like a mount should be accepted: %v", err)
+	}
+}
+
+func TestMountRoutesToRegistries(t *testing.T) {
+	root := NewRegistry()
+	if err := root.AddJob("cleanup", func(map[string]string, string) bool { return true }); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	billing, search := NewRegistry(), NewRegistry()
+	if err := billing.AddRequestJob("reindex", func(req *JobRequest) bool {
+		_ = req.SetResult(req.Name)
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	if err := search.AddJob("reindex", func(args map[string]string, _ string) bool { return args["ok"] == "true" }); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(root))
+	var seen atomic.Value
+	logPath := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			seen.Store(r.URL.Path)
+			next.ServeHTTP(rw, r)
+		})
+	}
+	deny := func(http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			rw.WriteHeader(http.StatusForbidden)
+		})
+	}
+	if err := srv.Mount("billing", billing, logPath); err != nil {
+		t.Fatalf("mount failed: %v", err)
+	}
+	if err := srv.Mount("search", search); err != nil {
+		t.Fatalf("mount failed: %v", err)
+	}
+	if err := srv.Mount("locked", NewRegistry(), deny); err != nil {
+		t.Fatalf("mount failed: %v", err)
+	}
+
+	for _, target := range []string{"/billing.reindex", "/billing/reindex"} {
+		resp := serveJSON(t, srv, httptest.NewRequest(http.MethodGet, target, nil))
+		if resp.Status != base.SUCCESS || resp.Job != "billing.reindex" || string(resp.Result) != `"reindex"` {
+			t.Fatalf("%s: unexpected reply %+v", target, resp)
+		}
+		if seen.Load() != target {
+			t.Fatalf("middleware should see the original path %s, saw %v", target, seen.Load())
+		}
+	}
+	if resp := serveJSON(t, srv, httptest.NewRequest(http.MethodGet, "/search.reindex?ok=false", nil)); resp.Status != base.FAILURE || resp.Job != "search.reindex" {
+		t.Fatalf("the search registry should run its own job, got %+v", resp)
+	}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/locked.anything", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("mount middleware should apply, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, base.JobsPath+"?match=*.reindex", nil))
+	var infos []base.JobInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &infos); err != nil {
+		t.Fatalf("decode job list: %v", err)
+	}
+	if len(infos) != 2 || infos[0].Name != "billing.reindex" || infos[1].Name != "search.reindex" {
+		t.Fatalf("unexpected jobs for *.reindex: %+v", infos)
+	}
+
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, base.HistoryPath+"?job=billing.reindex", nil))
+	var records []base.RunRecord
+	if err := json.Unmarshal(rec.Body.Bytes(), &records); err != nil {
+		t.Fatalf("decode history: %v", err)
+	}
+	if len(records) != 2 || records[0].Job != "billing.reindex" {
+		t.Fatalf("unexpected history for billing.reindex: %+v", records)
+	}
+	if got := len(billing.History("reindex")); got != 2 {
+		t.Fatalf("the mounted registry should keep its own history, got %d runs", got)
+	}
+
+	if resp := serveJSON(t, srv, httptest.NewRequest(http.MethodPost, base.DisablePath+"?job=search.reindex&reason=maintenance", nil)); resp.Status != base.SUCCESS || resp.Job != "search.reindex" {
+		t.Fatalf("disable failed: %+v", resp)
+	}
+	if reason, disabled := search.disabledReason("reindex"); !disabled || reason != "maintenance" {
+		t.Fatalf("disable should reach the mounted registry, got %q %v", reason, disabled)
+	}
+
+	body, _ := json.Marshal(base.BatchRequest{Job: "billing.reindex", Items: []base.BatchItem{{}, {}}})
+	req := httptest.NewRequest(http.MethodPost, base.BatchPath, bytes.NewReader(body))
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	var batch base.BatchResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &batch); err != nil {
+		t.Fatalf("decode batch reply %q: %v", rec.Body.String(), err)
+	}
+	if batch.Job != "billing.reindex" || len(batch.Results) != 2 || batch.Results[1].Status != base.SUCCESS || batch.Results[1].Job != "billing.reindex" {
+		t.Fatalf("unexpected batch reply: %+v", batch)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		republished := false
+		for _, event := range root.RecentEvents() {
+			republished = republished || (event.Job == "billing.reindex" && event.Type == base.EventSucceeded)
+		}
+		if republished {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("events of the mount were not republished: %+v", root.RecentEvents())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStopNamespaceCoversMounts(t *testing.T) {
+	billing := NewRegistry()
+	started := make(chan struct{})
+	if err := billing.AddStoppableJob("export", func(args map[string]string, signature string, quit chan struct{}) bool {
+		close(started)
+		<-quit
+		return false
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(NewRegistry()))
+	if err := srv.Mount("acme.billing", billing); err != nil {
+		t.Fatalf("mount failed: %v", err)
+	}
+
+	done := serveAsync(srv, httptest.NewRequest(http.MethodGet, "/acme/billing/export", nil))
+	<-started
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, base.RunsPath, nil))
+	if !strings.Contains(rec.Body.String(), `"job":"acme.billing.export"`) {
+		t.Fatalf("runs of the mount should be listed with qualified names: %s", rec.Body.String())
+	}
+	if resp := serveJSON(t, srv, httptest.NewRequest(http.MethodPost, base.StopPath+"?namespace=acme", nil)); resp.Status != base.SUCCESS {
+		t.Fatalf("namespace stop failed: %+v", resp)
+	}
+	select {
+	case rec := <-done:
+		if resp := decodeReply(t, rec); resp.Status != base.INTERRUPT || resp.Job != "acme.billing.export" {
+			t.Fatalf("expected the mounted run to be interrupted, got %+v", resp)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the mounted run was not stopped")
+	}
+}
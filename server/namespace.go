@@ -0,0 +1,234 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/Kingson4Wu/saturncli/base"
+)
+
+// Namespace registers jobs under a common dotted prefix: a job added as
+// "reindex" to the namespace "billing" is named "billing.reindex". Namespaces
+// nest, can restrict who may use their jobs, and can stop all of their runs.
+type Namespace struct {
+	registry *Registry
+	name     string
+}
+
+// Group returns the namespace name of the package-level registry.
+func Group(name string) *Namespace {
+	return defaultRegistry.Group(name)
+}
+
+// Group returns the namespace name, which may itself be dotted. Nothing is
+// registered until a job is added to it.
+func (r *Registry) Group(name string) *Namespace {
+	return &Namespace{registry: r, name: name}
+}
+
+// Name returns the full dotted name of the namespace.
+func (n *Namespace) Name() string {
+	return n.name
+}
+
+// Group returns the child namespace name of n.
+func (n *Namespace) Group(name string) *Namespace {
+	return n.registry.Group(n.jobName(name))
+}
+
+func (n *Namespace) jobName(name string) string {
+	return n.name + base.NamespaceSeparator + name
+}
+
+// AddJob registers a non-stoppable job in the namespace.
+func (n *Namespace) AddJob(name string, handler JobHandler, opts ...JobOption) error {
+	return n.registry.AddJob(n.jobName(name), handler, opts...)
+}
+
+// AddStoppableJob registers a stoppable job in the namespace.
+func (n *Namespace) AddStoppableJob(name string, handler StoppableJobHandler, opts ...JobOption) error {
+	return n.registry.AddStoppableJob(n.jobName(name), handler, opts...)
+}
+
+// AddContextJob registers a context-aware job in the namespace.
+func (n *Namespace) AddContextJob(name string, handler ContextJobHandler, opts ...JobOption) error {
+	return n.registry.AddContextJob(n.jobName(name), handler, opts...)
+}
+
+// AddRequestJob registers a request-style job in the namespace.
+func (n *Namespace) AddRequestJob(name string, handler RequestJobHandler, opts ...JobOption) error {
+	return n.registry.AddRequestJob(n.jobName(name), handler, opts...)
+}
+
+// AddWorkflow registers a workflow in the namespace. Its steps name jobs by
+// their full names, so they may belong to any namespace whose ACL allows the
+// workflow's caller.
+func (n *Namespace) AddWorkflow(name string, workflow Workflow, opts ...JobOption) error {
+	return n.registry.AddWorkflow(n.jobName(name), workflow, opts...)
+}
+
+// SetACL restricts who may run, stop, pause, resume, disable and enable the
+// jobs of the namespace and of its children, and see their runs, history,
+// events and queued runs. A job is usable only when the ACL of every
+// namespace above it allows the caller; nil removes the ACL.
+func (n *Namespace) SetACL(acl ACL) {
+	n.registry.jobsMu.Lock()
+	defer n.registry.jobsMu.Unlock()
+	if acl == nil {
+		delete(n.registry.acls, n.name)
+		return
+	}
+	n.registry.acls[n.name] = acl
+}
+
+// Stop asks every run in flight of the namespace's jobs to stop and returns
+// how many were asked.
+func (n *Namespace) Stop() int {
+	return n.registry.StopNamespace(n.name)
+}
+
+// Caller identifies the process on the other end of a request. Peer
+// credentials are read from unix socket connections on Linux; elsewhere
+// Known is false. Token is whatever the client sent in the base.CallerToken
+// header; it is not verified, so ACLs do not rely on it.
+type Caller struct {
+	UID   int
+	GID   int
+	PID   int
+	Known bool
+	Token string
+}
+
+// ACL decides whether a caller may use the jobs of a namespace.
+type ACL func(Caller) bool
+
+// AllowUIDs admits callers running as one of uids. Unknown callers are refused.
+func AllowUIDs(uids ...int) ACL {
+	return func(c Caller) bool {
+		return c.Known && containsInt(uids, c.UID)
+	}
+}
+
+// AllowGIDs admits callers whose primary group is one of gids. Unknown
+// callers are refused.
+func AllowGIDs(gids ...int) ACL {
+	return func(c Caller) bool {
+		return c.Known && containsInt(gids, c.GID)
+	}
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// StopNamespace asks every run in flight of the jobs below namespace to stop
+// and returns how many were asked.
+func (r *Registry) StopNamespace(namespace string) int {
+	return r.stopRuns(namespace + base.NamespaceSeparator)
+}
+
+// stopRuns stops the runs of every job whose name starts with prefix.
+func (r *Registry) stopRuns(prefix string) int {
+	return r.stopWhere(func(job string, _ *activeRun) bool {
+		return strings.HasPrefix(job, prefix)
+	}, "")
+}
+
+// allows reports whether caller passes the ACL of every namespace above name.
+func (r *Registry) allows(name string, caller Caller) bool {
+	r.jobsMu.RLock()
+	defer r.jobsMu.RUnlock()
+	for i := strings.LastIndex(name, base.NamespaceSeparator); i > 0; i = strings.LastIndex(name[:i], base.NamespaceSeparator) {
+		if acl, ok := r.acls[name[:i]]; ok && !acl(caller) {
+			return false
+		}
+	}
+	return true
+}
+
+// validateJobName rejects names that cannot be told apart from a URL path or
+// a namespace: names are dot-separated segments without slashes or
+// wildcards, and the first segment must not be reserved.
+func validateJobName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return errors.New("job name is empty")
+	}
+	if strings.ContainsAny(name, "/*?[]\\") {
+		return fmt.Errorf("job name %q must not contain '/' or wildcards; separate namespaces with %q", name, base.NamespaceSeparator)
+	}
+	segments := strings.Split(name, base.NamespaceSeparator)
+	for _, segment := range segments {
+		if segment == "" {
+			return fmt.Errorf("job name %q has an empty namespace", name)
+		}
+	}
+	if segments[0] == base.ReservedNamespace {
+		return errors.New("job name uses the reserved admin prefix")
+	}
+	return nil
+}
+
+// jobNameFromPath maps a request path to a job name: "/billing/reindex"
+// and "/billing.reindex" both name the job billing.reindex.
+func jobNameFromPath(urlPath string) string {
+	return strings.ReplaceAll(strings.Trim(urlPath, "/"), "/", base.NamespaceSeparator)
+}
+
+// matchJobName reports whether name matches pattern, in which '*' matches
+// any run of characters, dots included, so "billing.*" matches every job
+// below billing.
+func matchJobName(pattern, name string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, err := path.Match(pattern, name)
+	return err == nil && ok
+}
+
+type callerKey struct{}
+
+// connContext records the peer credentials of a new connection so handlers
+// can authorise its requests; it is used as http.Server.ConnContext.
+func connContext(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, callerKey{}, peerCaller(conn))
+}
+
+func callerOf(r *http.Request) Caller {
+	caller, _ := r.Context().Value(callerKey{}).(Caller)
+	caller.Token = r.Header.Get(base.CallerToken)
+	return caller
+}
+
+// authorize replies 403 and reports false when the caller of r may not use
+// the job name.
+func (s *ser) authorize(rw http.ResponseWriter, r *http.Request, name string) bool {
+	caller := callerOf(r)
+	if s.registry.allows(name, caller) {
+		return true
+	}
+	s.reply(rw, r, http.StatusForbidden, base.Response{Status: base.FAILURE, Job: name, Message: "caller is not allowed to use this job"})
+	s.logger.Warnf("saturn server caller refused, name:%s, uid: %d, pid: %d", name, caller.UID, caller.PID)
+	return false
+}
+
+// allows reports whether caller may use the job clients know by name, under
+// the ACLs of the server's registry and of the mount serving the job.
+func (s *ser) allows(name string, caller Caller) bool {
+	if !s.registry.allows(name, caller) {
+		return false
+	}
+	if m, ok := s.mountFor(name); ok {
+		return m.server.registry.allows(m.local(name), caller)
+	}
+	return true
+}
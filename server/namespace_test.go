@@ -0,0 +1,209 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+	"github.com/Kingson4Wu/saturncli/utils"
+)
+
+func TestNamespaceRoutingAndListing(t *testing.T) {
+	registry := NewRegistry()
+	billing := registry.Group("billing")
+	ok := func(map[string]string, string) bool { return true }
+	if err := billing.AddJob("reindex", ok); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	if err := billing.Group("invoices").AddJob("send", ok); err != nil {
+		t.Fatalf("failed to add nested job: %v", err)
+	}
+	if err := registry.AddJob("cleanup", ok); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	for _, name := range []string{"billing/reindex", "billing..reindex", ".reindex", "billing.*", "_saturn.jobs"} {
+		if err := registry.AddJob(name, ok); err == nil {
+			t.Fatalf("name %q should be rejected", name)
+		}
+	}
+
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry))
+	for _, target := range []string{"/billing.reindex", "/billing/reindex", "/billing/invoices/send"} {
+		if resp := serveJSON(t, srv, httptest.NewRequest(http.MethodGet, target, nil)); resp.Status != base.SUCCESS {
+			t.Fatalf("%s: expected success, got %+v", target, resp)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, base.JobsPath+"?match=billing.*", nil))
+	var infos []base.JobInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &infos); err != nil {
+		t.Fatalf("decode job list: %v", err)
+	}
+	if len(infos) != 2 || infos[0].Name != "billing.invoices.send" || infos[1].Name != "billing.reindex" {
+		t.Fatalf("unexpected jobs for billing.*: %+v", infos)
+	}
+}
+
+func TestNamespaceACL(t *testing.T) {
+	registry := NewRegistry()
+	billing := registry.Group("billing")
+	ok := func(map[string]string, string) bool { return true }
+	if err := billing.Group("invoices").AddJob("send", ok); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	if err := registry.AddJob("cleanup", ok); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	billing.SetACL(AllowUIDs(7, 8))
+	billing.Group("invoices").SetACL(AllowUIDs(8))
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry))
+
+	as := func(caller Caller, target string) base.Response {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		return serveJSON(t, srv, req.WithContext(context.WithValue(req.Context(), callerKey{}, caller)))
+	}
+	cases := []struct {
+		caller Caller
+		target string
+		want   string
+	}{
+		{Caller{}, "/billing.invoices.send", base.FAILURE},
+		{Caller{UID: 7, Known: true}, "/billing.invoices.send", base.FAILURE},
+		{Caller{UID: 8, Known: true}, "/billing.invoices.send", base.SUCCESS},
+		{Caller{}, "/cleanup", base.SUCCESS},
+		{Caller{UID: 8, Known: true}, base.DisablePath + "?job=billing.invoices.send", base.SUCCESS},
+		{Caller{UID: 7, Known: true}, base.EnablePath + "?job=billing.invoices.send", base.FAILURE},
+	}
+	for _, c := range cases {
+		if resp := as(c.caller, c.target); resp.Status != c.want {
+			t.Fatalf("%+v %s: expected %s, got %+v", c.caller, c.target, c.want, resp)
+		}
+	}
+
+	history := func(caller Caller, target string) (int, []base.RunRecord) {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req.WithContext(context.WithValue(req.Context(), callerKey{}, caller)))
+		var records []base.RunRecord
+		_ = json.Unmarshal(rec.Body.Bytes(), &records)
+		return rec.Code, records
+	}
+	if _, records := history(Caller{}, base.HistoryPath); len(records) != 1 || records[0].Job != "cleanup" {
+		t.Fatalf("history should hide runs of jobs the caller may not use, got %+v", records)
+	}
+	if _, records := history(Caller{UID: 8, Known: true}, base.HistoryPath); len(records) != 2 {
+		t.Fatalf("an allowed caller should see every run, got %+v", records)
+	}
+	if code, _ := history(Caller{}, base.HistoryPath+"?job=billing.invoices.send"); code != http.StatusForbidden {
+		t.Fatalf("reading the history of a refused job should be forbidden, got %d", code)
+	}
+
+	billing.SetACL(nil)
+	billing.Group("invoices").SetACL(nil)
+	if resp := as(Caller{}, base.EnablePath+"?job=billing.invoices.send"); resp.Status != base.SUCCESS {
+		t.Fatalf("removing the ACLs should admit everyone, got %+v", resp)
+	}
+}
+
+// withCaller makes req arrive from caller, as the peer credentials would.
+func withCaller(req *http.Request, caller Caller) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), callerKey{}, caller))
+}
+
+func TestJobListingHidesRunsOfRefusedJobs(t *testing.T) {
+	registry := NewRegistry()
+	billing := registry.Group("billing")
+	started, exit := make(chan struct{}), make(chan struct{})
+	if err := billing.AddStoppableJob("send", func(_ map[string]string, _ string, quit chan struct{}) bool {
+		close(started)
+		<-quit
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	billing.SetACL(AllowUIDs(8))
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry))
+	go func() {
+		srv.ServeHTTP(httptest.NewRecorder(), withCaller(httptest.NewRequest(http.MethodGet, "/billing.send", nil), Caller{UID: 8, Known: true}))
+		close(exit)
+	}()
+	<-started
+
+	list := func(caller Caller) []base.JobInfo {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, withCaller(httptest.NewRequest(http.MethodGet, base.JobsPath, nil), caller))
+		var infos []base.JobInfo
+		if err := json.Unmarshal(rec.Body.Bytes(), &infos); err != nil {
+			t.Fatalf("decode job list: %v", err)
+		}
+		return infos
+	}
+	if infos := list(Caller{}); len(infos) != 1 || len(infos[0].Running) != 0 {
+		t.Fatalf("the listing should hide runs of jobs the caller may not use, got %+v", infos)
+	}
+	if infos := list(Caller{UID: 8, Known: true}); len(infos) != 1 || len(infos[0].Running) != 1 {
+		t.Fatalf("an allowed caller should see the run, got %+v", infos)
+	}
+	registry.StopNamespace("billing")
+	<-exit
+}
+
+func TestStopNamespace(t *testing.T) {
+	registry := NewRegistry()
+	started := make(chan struct{}, 3)
+	wait := func(args map[string]string, signature string, quit chan struct{}) bool {
+		started <- struct{}{}
+		<-quit
+		return false
+	}
+	billing := registry.Group("billing")
+	for _, name := range []string{"reindex", "export"} {
+		if err := billing.AddStoppableJob(name, wait); err != nil {
+			t.Fatalf("failed to add job: %v", err)
+		}
+	}
+	if err := registry.AddStoppableJob("billingreport", wait); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry))
+
+	done := map[string]<-chan *httptest.ResponseRecorder{}
+	for _, job := range []string{"billing.reindex", "billing.export", "billingreport"} {
+		done[job] = serveAsync(srv, httptest.NewRequest(http.MethodGet, "/"+job, nil))
+	}
+	for i := 0; i < 3; i++ {
+		<-started
+	}
+
+	if resp := serveJSON(t, srv, httptest.NewRequest(http.MethodPost, base.StopPath+"?namespace=billing.*", nil)); resp.Status != base.SUCCESS {
+		t.Fatalf("namespace stop failed: %+v", resp)
+	}
+	for _, job := range []string{"billing.reindex", "billing.export"} {
+		select {
+		case rec := <-done[job]:
+			if resp := decodeReply(t, rec); resp.Status != base.INTERRUPT {
+				t.Fatalf("%s should be stopped, got %+v", job, resp)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("namespace runs were not stopped")
+		}
+	}
+	select {
+	case rec := <-done["billingreport"]:
+		t.Fatalf("only billing jobs should be stopped, got %s", rec.Body.String())
+	default:
+	}
+	if got := registry.StopNamespace("billing"); got != 0 {
+		t.Fatalf("expected nothing left to stop in billing, stopped %d", got)
+	}
+	if got := registry.Group("billingreport").Stop(); got != 0 {
+		t.Fatalf("a job is not a namespace, stopped %d", got)
+	}
+	registry.stopAll("billingreport")
+	<-done["billingreport"]
+}
@@ -0,0 +1,298 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+	"github.com/Kingson4Wu/saturncli/utils"
+	"github.com/google/uuid"
+)
+
+// Headers sent with every webhook delivery.
+const (
+	WebhookSignatureHeader = "X-Saturn-Signature"
+	WebhookEventHeader     = "X-Saturn-Event"
+	WebhookDeliveryHeader  = "X-Saturn-Delivery"
+)
+
+const (
+	defaultWebhookAttempts = 5
+	defaultWebhookBackoff  = time.Second
+	maxWebhookBackoff      = time.Minute
+	defaultWebhookTimeout  = 10 * time.Second
+	// maxDeadLetters bounds the dead letters kept in memory; older ones are
+	// dropped, and only the dead-letter log keeps every one.
+	maxDeadLetters = 1000
+)
+
+// Webhook is a receiver notified when runs finish.
+type Webhook struct {
+	URL string
+	// Secret signs every payload with HMAC-SHA256; leave empty to send unsigned.
+	Secret string
+	// Jobs limits deliveries to these jobs; empty means every job.
+	Jobs []string
+	// Events limits deliveries to these event types; empty means the terminal
+	// events succeeded, failed, interrupted, timed_out, skipped and abandoned.
+	Events []string
+}
+
+func (w *Webhook) wants(event base.Event) bool {
+	if len(w.Jobs) > 0 && !containsString(w.Jobs, event.Job) {
+		return false
+	}
+	if len(w.Events) > 0 {
+		return containsString(w.Events, event.Type)
+	}
+	switch event.Type {
+	case base.EventSucceeded, base.EventFailed, base.EventInterrupted, base.EventTimedOut, base.EventSkipped, base.EventAbandoned:
+		return true
+	default:
+		return false
+	}
+}
+
+// DeadLetter records a delivery that was given up on.
+type DeadLetter struct {
+	URL      string     `json:"url"`
+	Event    base.Event `json:"event"`
+	Attempts int        `json:"attempts"`
+	Error    string     `json:"error"`
+	Time     time.Time  `json:"time"`
+}
+
+// NotifierOption customises a Notifier.
+type NotifierOption func(*Notifier)
+
+// WithWebhook adds a receiver; it can be given several times.
+func WithWebhook(hook Webhook) NotifierOption {
+	return func(n *Notifier) {
+		n.hooks = append(n.hooks, hook)
+	}
+}
+
+// WithRetry sets how many times a delivery is attempted and the delay before
+// the first retry, which doubles after every failure up to one minute.
+func WithRetry(attempts int, backoff time.Duration) NotifierOption {
+	return func(n *Notifier) {
+		if attempts > 0 {
+			n.attempts = attempts
+		}
+		if backoff > 0 {
+			n.backoff = backoff
+		}
+	}
+}
+
+// WithDeadLetterLog appends every abandoned delivery to w as a JSON line.
+func WithDeadLetterLog(w io.Writer) NotifierOption {
+	return func(n *Notifier) {
+		n.deadLetterLog = w
+	}
+}
+
+// WithNotifierHTTPClient replaces the client used for deliveries.
+func WithNotifierHTTPClient(client *http.Client) NotifierOption {
+	return func(n *Notifier) {
+		if client != nil {
+			n.httpc = client
+		}
+	}
+}
+
+// Notifier POSTs run events to webhooks. Each delivery is retried with
+// exponential backoff on network errors, 429 and 5xx replies; deliveries that
+// still fail, or are rejected with another status, go to the dead-letter log.
+type Notifier struct {
+	logger        utils.Logger
+	hooks         []Webhook
+	attempts      int
+	backoff       time.Duration
+	httpc         *http.Client
+	deadLetterLog io.Writer
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	closed  bool
+	letters []DeadLetter
+}
+
+// NewNotifier builds a notifier; call Attach to start receiving events.
+func NewNotifier(logger utils.Logger, opts ...NotifierOption) *Notifier {
+	n := &Notifier{
+		logger:   logger,
+		attempts: defaultWebhookAttempts,
+		backoff:  defaultWebhookBackoff,
+		httpc:    &http.Client{Timeout: defaultWebhookTimeout},
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(n)
+		}
+	}
+	n.ctx, n.cancel = context.WithCancel(context.Background())
+	return n
+}
+
+// Attach subscribes the notifier to registry's events until the returned
+// function is called.
+func (n *Notifier) Attach(registry *Registry) (detach func()) {
+	return registry.Subscribe(n.Notify)
+}
+
+// Notify delivers event to every webhook interested in it, in the background.
+func (n *Notifier) Notify(event base.Event) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.closed {
+		return
+	}
+	for i := range n.hooks {
+		hook := &n.hooks[i]
+		if !hook.wants(event) {
+			continue
+		}
+		n.wg.Add(1)
+		go func() {
+			defer n.wg.Done()
+			n.deliver(hook, event)
+		}()
+	}
+}
+
+// Close abandons pending retries and cancels in-flight deliveries, sending
+// them to the dead-letter log, and waits for their goroutines to end.
+func (n *Notifier) Close() {
+	n.mu.Lock()
+	n.closed = true
+	n.mu.Unlock()
+	n.cancel()
+	n.wg.Wait()
+}
+
+// DeadLetters returns the latest deliveries given up on, oldest first; at
+// most 1000 are kept.
+func (n *Notifier) DeadLetters() []DeadLetter {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]DeadLetter(nil), n.letters...)
+}
+
+func (n *Notifier) deliver(hook *Webhook, event base.Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		n.deadLetter(hook, event, 0, err)
+		return
+	}
+	delivery := ""
+	if v, err := uuid.NewUUID(); err == nil {
+		delivery = v.String()
+	}
+
+	backoff := n.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := n.post(hook, event, delivery, body)
+		if err == nil {
+			return
+		}
+		n.logger.Warnf("saturn server webhook delivery failed, url: %s, job: %s, signature: %s, attempt: %d, err: %v", hook.URL, event.Job, event.Signature, attempt, err)
+		if !retry || attempt >= n.attempts {
+			n.deadLetter(hook, event, attempt, err)
+			return
+		}
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-n.ctx.Done():
+			timer.Stop()
+			n.deadLetter(hook, event, attempt, err)
+			return
+		}
+		if backoff *= 2; backoff > maxWebhookBackoff {
+			backoff = maxWebhookBackoff
+		}
+	}
+}
+
+// post makes one delivery attempt and reports whether a failure is worth retrying.
+func (n *Notifier) post(hook *Webhook, event base.Event, delivery string, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(n.ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", base.JSONContentType)
+	req.Header.Set(WebhookEventHeader, event.Type)
+	req.Header.Set(WebhookDeliveryHeader, delivery)
+	if hook.Secret != "" {
+		req.Header.Set(WebhookSignatureHeader, SignWebhook(hook.Secret, body))
+	}
+	response, err := n.httpc.Do(req)
+	if err != nil {
+		return true, err
+	}
+	_, _ = io.Copy(io.Discard, response.Body)
+	_ = response.Body.Close()
+	switch {
+	case response.StatusCode >= 200 && response.StatusCode < 300:
+		return false, nil
+	case response.StatusCode == http.StatusTooManyRequests, response.StatusCode >= 500:
+		return true, fmt.Errorf("receiver replied %s", response.Status)
+	default:
+		return false, fmt.Errorf("receiver replied %s", response.Status)
+	}
+}
+
+func (n *Notifier) deadLetter(hook *Webhook, event base.Event, attempts int, err error) {
+	letter := DeadLetter{URL: hook.URL, Event: event, Attempts: attempts, Error: err.Error(), Time: time.Now()}
+	n.logger.Errorf("saturn server webhook delivery abandoned, url: %s, job: %s, signature: %s, attempts: %d, err: %v", hook.URL, event.Job, event.Signature, attempts, err)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if len(n.letters) >= maxDeadLetters {
+		n.letters = append(n.letters[:0], n.letters[len(n.letters)-maxDeadLetters+1:]...)
+	}
+	n.letters = append(n.letters, letter)
+	if n.deadLetterLog != nil {
+		if data, err := json.Marshal(letter); err == nil {
+			_, _ = n.deadLetterLog.Write(append(data, '\n'))
+		}
+	}
+}
+
+// SignWebhook returns the signature header value for body: "sha256=" followed
+// by the hex HMAC-SHA256 of body keyed with secret.
+func SignWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook reports whether signature, as sent in the signature header,
+// matches body. Receivers use it to reject forged deliveries.
+func VerifyWebhook(secret string, body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(SignWebhook(secret, body)))
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
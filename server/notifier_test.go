@@ -0,0 +1,223 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+	"github.com/Kingson4Wu/saturncli/utils"
+)
+
+func TestNotifierDeliversSignedPayloadWithRetry(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts int
+		received = make(chan base.Event, 1)
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !VerifyWebhook("s3cret", body, r.Header.Get(WebhookSignatureHeader)) {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		mu.Lock()
+		attempts++
+		first := attempts == 1
+		mu.Unlock()
+		if first {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var event base.Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			rw.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received <- event
+	}))
+	defer receiver.Close()
+	rejecting := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusBadRequest)
+	}))
+	defer rejecting.Close()
+
+	registry := NewRegistry()
+	if err := registry.AddJob("nightly", func(args map[string]string, signature string) bool {
+		return false
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	if err := registry.AddJob("other", func(args map[string]string, signature string) bool {
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+
+	var deadLetterLog bytes.Buffer
+	notifier := NewNotifier(&utils.DefaultLogger{},
+		WithWebhook(Webhook{URL: receiver.URL, Secret: "s3cret", Jobs: []string{"nightly"}}),
+		WithWebhook(Webhook{URL: rejecting.URL, Events: []string{base.EventSucceeded}}),
+		WithRetry(3, 10*time.Millisecond),
+		WithDeadLetterLog(&deadLetterLog),
+	)
+	detach := notifier.Attach(registry)
+	defer detach()
+
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry))
+	serveJSON(t, srv, httptest.NewRequest(http.MethodGet, "/nightly", nil))
+	serveJSON(t, srv, httptest.NewRequest(http.MethodGet, "/other", nil))
+
+	select {
+	case event := <-received:
+		if event.Type != base.EventFailed || event.Job != "nightly" || event.Signature == "" {
+			t.Fatalf("unexpected payload: %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+
+	// the subscriber goroutine delivers asynchronously; wait for the rejection
+	deadline := time.Now().Add(2 * time.Second)
+	for len(notifier.DeadLetters()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Close cancels deliveries in flight, so let the successful one finish
+	notifier.wg.Wait()
+	notifier.Close()
+
+	mu.Lock()
+	if attempts != 2 {
+		t.Fatalf("expected one retry after the 503, got %d attempts", attempts)
+	}
+	mu.Unlock()
+	letters := notifier.DeadLetters()
+	if len(letters) != 1 || letters[0].URL != rejecting.URL || letters[0].Attempts != 1 || letters[0].Event.Job != "other" {
+		t.Fatalf("expected the rejected delivery in the dead-letter log, got %+v", letters)
+	}
+	var logged DeadLetter
+	if err := json.Unmarshal(deadLetterLog.Bytes(), &logged); err != nil || logged.URL != rejecting.URL {
+		t.Fatalf("dead-letter log not written: %q, %v", deadLetterLog.String(), err)
+	}
+}
+
+func TestVerifyWebhook(t *testing.T) {
+	body := []byte(`{"type":"succeeded"}`)
+	signature := SignWebhook("key", body)
+	if !VerifyWebhook("key", body, signature) {
+		t.Fatal("expected signature to verify")
+	}
+	if VerifyWebhook("other", body, signature) || VerifyWebhook("key", []byte("{}"), signature) || VerifyWebhook("key", body, "") {
+		t.Fatal("expected mismatched signatures to be rejected")
+	}
+}
+
+func TestNotifierReportsAbandonedRuns(t *testing.T) {
+	received := make(chan base.Event, 4)
+	receiver := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		var event base.Event
+		if err := json.NewDecoder(r.Body).Decode(&event); err == nil {
+			received <- event
+		}
+	}))
+	defer receiver.Close()
+
+	registry := NewRegistry()
+	started, exit := make(chan struct{}), make(chan struct{})
+	defer close(exit)
+	if err := registry.AddStoppableJob("stuck", func(_ map[string]string, _ string, _ chan struct{}) bool {
+		close(started)
+		<-exit
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	detach := NewNotifier(&utils.DefaultLogger{}, WithWebhook(Webhook{URL: receiver.URL})).Attach(registry)
+	defer detach()
+
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry))
+	req := httptest.NewRequest(http.MethodGet, "/stuck", nil)
+	req.Header.Set(base.RunSignature, "s-1")
+	done := serveAsync(srv, req)
+	<-started
+	stop := httptest.NewRequest(http.MethodGet, "/stuck", nil)
+	stop.Header.Set(base.StopJobFlag, "true")
+	stop.Header.Set(base.StopWait, "10ms")
+	stop.Header.Set(base.StopForce, "true")
+	if resp := serveJSON(t, srv, stop); resp.State != base.RunAbandoned {
+		t.Fatalf("the forced stop should abandon the run, got %+v", resp)
+	}
+	if resp := decodeReply(t, <-done); resp.Status != base.ABANDONED {
+		t.Fatalf("expected the run to be abandoned, got %+v", resp)
+	}
+
+	select {
+	case event := <-received:
+		if event.Type != base.EventAbandoned || event.Job != "stuck" || event.Signature != "s-1" {
+			t.Fatalf("unexpected payload: %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the abandoned run was not delivered")
+	}
+}
+
+func TestNotifierCloseCancelsDeliveries(t *testing.T) {
+	arrived, hang := make(chan struct{}, 1), make(chan struct{})
+	receiver := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		arrived <- struct{}{}
+		select {
+		case <-hang:
+		case <-r.Context().Done():
+		}
+	}))
+	defer receiver.Close()
+	defer close(hang)
+
+	notifier := NewNotifier(&utils.DefaultLogger{}, WithWebhook(Webhook{URL: receiver.URL}))
+	notifier.Notify(base.Event{Type: base.EventSucceeded, Job: "report", Signature: "s-1"})
+	<-arrived
+	closed := make(chan struct{})
+	go func() {
+		notifier.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close should cancel the delivery in flight")
+	}
+	if letters := notifier.DeadLetters(); len(letters) != 1 || letters[0].Event.Signature != "s-1" {
+		t.Fatalf("the cancelled delivery should be dead-lettered, got %+v", letters)
+	}
+}
+
+func TestNotifierKeepsLatestDeadLetters(t *testing.T) {
+	notifier := NewNotifier(quietLogger{})
+	hook := &Webhook{URL: "http://receiver.invalid"}
+	for i := 0; i < maxDeadLetters+5; i++ {
+		notifier.deadLetter(hook, base.Event{Type: base.EventFailed, Signature: fmt.Sprint(i)}, 1, errors.New("receiver replied 500"))
+	}
+	letters := notifier.DeadLetters()
+	if len(letters) != maxDeadLetters || letters[0].Event.Signature != "5" || letters[len(letters)-1].Event.Signature != fmt.Sprint(maxDeadLetters+4) {
+		t.Fatalf("expected the latest %d dead letters, got %d starting at %s", maxDeadLetters, len(letters), letters[0].Event.Signature)
+	}
+}
+
+// quietLogger keeps tests that give up on many deliveries readable.
+type quietLogger struct{}
+
+func (quietLogger) Debugf(string, ...interface{}) {}
+func (quietLogger) Infof(string, ...interface{})  {}
+func (quietLogger) Warnf(string, ...interface{})  {}
+func (quietLogger) Errorf(string, ...interface{}) {}
+func (quietLogger) Debug(...interface{})          {}
+func (quietLogger) Info(...interface{})           {}
+func (quietLogger) Warn(...interface{})           {}
+func (quietLogger) Error(...interface{})          {}
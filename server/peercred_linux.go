@@ -0,0 +1,31 @@
+//go:build linux
+
+package server
+
+import (
+	"net"
+	"syscall"
+)
+
+// peerCaller reads the credentials of the process at the other end of a unix
+// socket connection.
+func peerCaller(conn net.Conn) Caller {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return Caller{}
+	}
+	raw, err := unixConn.SyscallConn()
+	if err != nil {
+		return Caller{}
+	}
+	var (
+		cred    *syscall.Ucred
+		credErr error
+	)
+	if err := raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	}); err != nil || credErr != nil {
+		return Caller{}
+	}
+	return Caller{UID: int(cred.Uid), GID: int(cred.Gid), PID: int(cred.Pid), Known: true}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package server
+
+import "net"
+
+// peerCaller cannot read peer credentials on this platform.
+func peerCaller(net.Conn) Caller {
+	return Caller{}
+}
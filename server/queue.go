@@ -0,0 +1,255 @@
+package server
+
+import (
+	"container/heap"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/Kingson4Wu/saturncli/base"
+)
+
+const (
+	defaultQueueWorkers  = 1
+	defaultQueueCapacity = 64
+)
+
+var (
+	errQueueFull      = errors.New("queue is full")
+	errQueueAbandoned = errors.New("run was abandoned while queued")
+)
+
+// WithQueue runs the job through the queue class: at most the class's
+// workers run at a time, and further runs wait in priority order. Give a job
+// a class of its own for a per-job pool, or share a class between jobs.
+// Classes are sized with WithQueueClass; unsized classes have one worker and
+// room for 64 waiting runs. Waiting runs are listed as queued, and stopping
+// one of a stoppable job takes it out of the queue before it starts.
+func WithQueue(class string) JobOption {
+	return func(j *notifyJob) {
+		j.queue = class
+	}
+}
+
+// WithQueueClass sizes a queue class: how many of its runs execute at a time
+// and how many may wait. Runs arriving when the queue is full are rejected
+// with status base.QUEUE_FULL.
+func WithQueueClass(class string, workers, capacity int) ServerOption {
+	return func(s *ser) {
+		s.queues.configure(class, workers, capacity)
+	}
+}
+
+// queueSet holds the queue classes of a server, created on first use.
+type queueSet struct {
+	mu      sync.Mutex
+	classes map[string]*runQueue
+}
+
+func newQueueSet() *queueSet {
+	return &queueSet{classes: make(map[string]*runQueue)}
+}
+
+func (qs *queueSet) configure(class string, workers, capacity int) {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	q := qs.getLocked(class)
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if workers > 0 {
+		q.workers = workers
+	}
+	if capacity > 0 {
+		q.capacity = capacity
+	}
+}
+
+func (qs *queueSet) get(class string) *runQueue {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	return qs.getLocked(class)
+}
+
+func (qs *queueSet) getLocked(class string) *runQueue {
+	q, ok := qs.classes[class]
+	if !ok {
+		q = &runQueue{class: class, workers: defaultQueueWorkers, capacity: defaultQueueCapacity}
+		qs.classes[class] = q
+	}
+	return q
+}
+
+// infos describes every queue class, sorted by name.
+func (qs *queueSet) infos() []base.QueueInfo {
+	qs.mu.Lock()
+	queues := make([]*runQueue, 0, len(qs.classes))
+	for _, q := range qs.classes {
+		queues = append(queues, q)
+	}
+	qs.mu.Unlock()
+	infos := make([]base.QueueInfo, 0, len(queues))
+	for _, q := range queues {
+		infos = append(infos, q.info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Class < infos[j].Class })
+	return infos
+}
+
+// queueInfos is queueSet.infos leaving out the waiting runs of jobs the
+// caller may not use; the counters still include them.
+func (s *ser) queueInfos(caller Caller) []base.QueueInfo {
+	infos := s.queues.infos()
+	for i := range infos {
+		waiting := []base.QueuedRun{}
+		for _, run := range infos[i].Waiting {
+			if s.allows(run.Job, caller) {
+				waiting = append(waiting, run)
+			}
+		}
+		infos[i].Waiting = waiting
+	}
+	return infos
+}
+
+// runQueue admits up to workers runs at a time; the others wait, highest
+// priority first and in arrival order within a priority.
+type runQueue struct {
+	class string
+
+	mu        sync.Mutex
+	workers   int
+	capacity  int
+	running   int
+	waiting   ticketHeap
+	seq       uint64
+	processed uint64
+	rejected  uint64
+}
+
+type queueTicket struct {
+	run   base.QueuedRun
+	seq   uint64
+	index int
+	ready chan struct{}
+}
+
+// acquire waits for a worker for run. onQueued is told the run's position
+// when it has to wait. Waiting ends early when cancel or quit is closed.
+func (q *runQueue) acquire(run base.QueuedRun, cancel, quit <-chan struct{}, onQueued func(position int)) error {
+	q.mu.Lock()
+	if q.running < q.workers && len(q.waiting) == 0 {
+		q.running++
+		q.mu.Unlock()
+		return nil
+	}
+	if len(q.waiting) >= q.capacity {
+		q.rejected++
+		q.mu.Unlock()
+		return errQueueFull
+	}
+	q.seq++
+	ticket := &queueTicket{run: run, seq: q.seq, ready: make(chan struct{})}
+	heap.Push(&q.waiting, ticket)
+	position := q.positionLocked(ticket)
+	q.mu.Unlock()
+	onQueued(position)
+
+	select {
+	case <-ticket.ready:
+		return nil
+	case <-cancel:
+	case <-quit:
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if ticket.index >= 0 {
+		heap.Remove(&q.waiting, ticket.index)
+	} else {
+		// the worker was handed over as the wait ended; pass it on
+		q.handOverLocked()
+	}
+	return errQueueAbandoned
+}
+
+// release gives back the worker of a finished run.
+func (q *runQueue) release() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.processed++
+	q.handOverLocked()
+}
+
+func (q *runQueue) handOverLocked() {
+	if len(q.waiting) > 0 && q.running <= q.workers {
+		close(heap.Pop(&q.waiting).(*queueTicket).ready)
+		return
+	}
+	q.running--
+}
+
+func (q *runQueue) positionLocked(ticket *queueTicket) int {
+	position := 1
+	for _, other := range q.waiting {
+		if other != ticket && other.before(ticket) {
+			position++
+		}
+	}
+	return position
+}
+
+func (q *runQueue) info() base.QueueInfo {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	tickets := append([]*queueTicket(nil), q.waiting...)
+	sort.Slice(tickets, func(i, j int) bool { return tickets[i].before(tickets[j]) })
+	info := base.QueueInfo{
+		Class:     q.class,
+		Workers:   q.workers,
+		Running:   q.running,
+		Depth:     len(tickets),
+		Capacity:  q.capacity,
+		Processed: q.processed,
+		Rejected:  q.rejected,
+		Waiting:   make([]base.QueuedRun, 0, len(tickets)),
+	}
+	for i, ticket := range tickets {
+		run := ticket.run
+		run.Position = i + 1
+		info.Waiting = append(info.Waiting, run)
+	}
+	return info
+}
+
+func (t *queueTicket) before(other *queueTicket) bool {
+	if t.run.Priority != other.run.Priority {
+		return t.run.Priority > other.run.Priority
+	}
+	return t.seq < other.seq
+}
+
+// ticketHeap implements heap.Interface with the next run to admit on top.
+type ticketHeap []*queueTicket
+
+func (h ticketHeap) Len() int           { return len(h) }
+func (h ticketHeap) Less(i, j int) bool { return h[i].before(h[j]) }
+
+func (h ticketHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *ticketHeap) Push(x any) {
+	ticket := x.(*queueTicket)
+	ticket.index = len(*h)
+	*h = append(*h, ticket)
+}
+
+func (h *ticketHeap) Pop() any {
+	old := *h
+	ticket := old[len(old)-1]
+	old[len(old)-1] = nil
+	ticket.index = -1
+	*h = old[:len(old)-1]
+	return ticket
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+	"github.com/Kingson4Wu/saturncli/utils"
+)
+
+func TestRunQueueOrdersByPriority(t *testing.T) {
+	q := &runQueue{class: "reports", workers: 1, capacity: 3}
+	if err := q.acquire(base.QueuedRun{Signature: "first"}, nil, nil, nil); err != nil {
+		t.Fatalf("the first run should get the worker: %v", err)
+	}
+
+	admitted := make(chan string, 3)
+	positions := make(chan int, 3)
+	cancelLow := make(chan struct{})
+	wait := func(signature string, priority int, cancel chan struct{}) {
+		go func() {
+			err := q.acquire(base.QueuedRun{Signature: signature, Priority: priority}, cancel, nil, func(position int) { positions <- position })
+			if err == nil {
+				admitted <- signature
+			} else {
+				admitted <- signature + ": " + err.Error()
+			}
+		}()
+		<-positions
+	}
+	wait("normal", 0, nil)
+	wait("low", -1, cancelLow)
+	wait("urgent", 5, nil)
+	if err := q.acquire(base.QueuedRun{Signature: "overflow"}, nil, nil, nil); err != errQueueFull {
+		t.Fatalf("expected the full queue to reject, got %v", err)
+	}
+
+	info := q.info()
+	if info.Depth != 3 || info.Running != 1 || info.Rejected != 1 {
+		t.Fatalf("unexpected queue info: %+v", info)
+	}
+	for i, want := range []string{"urgent", "normal", "low"} {
+		if info.Waiting[i].Signature != want || info.Waiting[i].Position != i+1 {
+			t.Fatalf("unexpected waiting order: %+v", info.Waiting)
+		}
+	}
+
+	close(cancelLow)
+	if got := <-admitted; got != "low: "+errQueueAbandoned.Error() {
+		t.Fatalf("expected the low run to be abandoned, got %s", got)
+	}
+	for _, want := range []string{"urgent", "normal"} {
+		q.release()
+		if got := <-admitted; got != want {
+			t.Fatalf("expected %s to be admitted next, got %s", want, got)
+		}
+	}
+	q.release()
+	if info := q.info(); info.Running != 0 || info.Depth != 0 || info.Processed != 3 {
+		t.Fatalf("unexpected queue info after draining: %+v", info)
+	}
+}
+
+func TestQueuedJob(t *testing.T) {
+	registry := NewRegistry()
+	started, release := make(chan string, 2), make(chan struct{})
+	if err := registry.AddJob("report", func(_ map[string]string, signature string) bool {
+		started <- signature
+		<-release
+		return true
+	}, WithQueue("reports")); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry), WithQueueClass("reports", 1, 1))
+	events, cancel := registry.SubscribeChan()
+	defer cancel()
+
+	run := func(signature string) <-chan *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/report", nil)
+		req.Header.Set(base.RunSignature, signature)
+		return serveAsync(srv, req)
+	}
+	first := run("first")
+	<-started
+	second := run("second")
+	for event := range events {
+		if event.Type == base.EventQueued {
+			if event.Signature != "second" || event.Message != "position 1 in queue reports" {
+				t.Fatalf("unexpected queued event: %+v", event)
+			}
+			break
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, base.QueuePath, nil))
+	var queues []base.QueueInfo
+	if err := json.Unmarshal(rec.Body.Bytes(), &queues); err != nil {
+		t.Fatalf("decode queues: %v", err)
+	}
+	if len(queues) != 1 || queues[0].Depth != 1 || queues[0].Waiting[0].Job != "report" || queues[0].Waiting[0].Position != 1 {
+		t.Fatalf("unexpected queues: %+v", queues)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/report", nil)
+	req.Header.Set("Accept", base.JSONContentType)
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("a full queue should answer 503, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	close(release)
+	for _, done := range []<-chan *httptest.ResponseRecorder{first, second} {
+		select {
+		case rec := <-done:
+			if resp := decodeReply(t, rec); resp.Status != base.SUCCESS {
+				t.Fatalf("queued runs should succeed, got %+v", resp)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("queued run did not finish")
+		}
+	}
+	if signature := <-started; signature != "second" {
+		t.Fatalf("expected the queued run to start, got %s", signature)
+	}
+}
+
+func TestStopQueuedRun(t *testing.T) {
+	registry := NewRegistry()
+	started, release := make(chan string, 2), make(chan struct{})
+	if err := registry.AddStoppableJob("report", func(_ map[string]string, signature string, quit chan struct{}) bool {
+		started <- signature
+		select {
+		case <-release:
+		case <-quit:
+		}
+		return true
+	}, WithQueue("reports")); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry), WithQueueClass("reports", 1, 2))
+	events, cancel := registry.SubscribeChan()
+	defer cancel()
+
+	run := func(signature string) <-chan *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/report", nil)
+		req.Header.Set(base.RunSignature, signature)
+		return serveAsync(srv, req)
+	}
+	first := run("first")
+	<-started
+	second, third := run("second"), run("third")
+	for queued := 0; queued < 2; {
+		if event := <-events; event.Type == base.EventQueued {
+			queued++
+		}
+	}
+	runs := registry.Runs("report")
+	if len(runs) != 3 || runs[0].State != base.RunRunning || runs[1].State != base.RunQueued || runs[2].State != base.RunQueued {
+		t.Fatalf("queued runs should be listed as queued, got %+v", runs)
+	}
+
+	stop := httptest.NewRequest(http.MethodGet, "/report", nil)
+	stop.Header.Set(base.StopJobFlag, "true")
+	stop.Header.Set(base.StopSignature, "second")
+	stop.Header.Set(base.StopWait, "1s")
+	if resp := serveJSON(t, srv, stop); resp.Status != base.SUCCESS || resp.State != base.RunStopped {
+		t.Fatalf("stopping a queued run should end it at once, got %+v", resp)
+	}
+	if resp := decodeReply(t, <-second); resp.Status != base.INTERRUPT || resp.Message != "job was stopped before it started" {
+		t.Fatalf("the queued run should be interrupted, got %+v", resp)
+	}
+	if stopped := registry.StopMatching(StopFilter{Job: "report", Params: map[string]string{}}, "cleanup"); stopped != 2 {
+		t.Fatalf("a filtered stop should reach running and queued runs, stopped %d", stopped)
+	}
+	if resp := decodeReply(t, <-third); resp.Status != base.INTERRUPT || resp.StopReason != "cleanup" {
+		t.Fatalf("the queued run should be interrupted, got %+v", resp)
+	}
+	if resp := decodeReply(t, <-first); resp.Status != base.INTERRUPT {
+		t.Fatalf("the running run should be interrupted, got %+v", resp)
+	}
+	close(release)
+	select {
+	case signature := <-started:
+		t.Fatalf("a stopped queued run must not start, %s did", signature)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestQueueListingHidesRefusedJobs(t *testing.T) {
+	registry := NewRegistry()
+	billing := registry.Group("billing")
+	started := make(chan struct{}, 2)
+	if err := billing.AddStoppableJob("report", func(_ map[string]string, _ string, quit chan struct{}) bool {
+		started <- struct{}{}
+		<-quit
+		return true
+	}, WithQueue("reports")); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	billing.SetACL(AllowUIDs(8))
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry), WithQueueClass("reports", 1, 1))
+	events, cancel := registry.SubscribeChan()
+	defer cancel()
+
+	allowed := Caller{UID: 8, Known: true}
+	done := make(chan struct{}, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			srv.ServeHTTP(httptest.NewRecorder(), withCaller(httptest.NewRequest(http.MethodGet, "/billing.report", nil), allowed))
+			done <- struct{}{}
+		}()
+	}
+	<-started
+	for event := range events {
+		if event.Type == base.EventQueued {
+			break
+		}
+	}
+
+	list := func(caller Caller) base.QueueInfo {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, withCaller(httptest.NewRequest(http.MethodGet, base.QueuePath, nil), caller))
+		var queues []base.QueueInfo
+		if err := json.Unmarshal(rec.Body.Bytes(), &queues); err != nil || len(queues) != 1 {
+			t.Fatalf("decode queues %q: %v", rec.Body.String(), err)
+		}
+		return queues[0]
+	}
+	if info := list(Caller{}); info.Depth != 1 || len(info.Waiting) != 0 {
+		t.Fatalf("the listing should hide runs of jobs the caller may not use, got %+v", info)
+	}
+	if info := list(allowed); len(info.Waiting) != 1 || info.Waiting[0].Job != "billing.report" {
+		t.Fatalf("an allowed caller should see the queued run, got %+v", info)
+	}
+	registry.StopNamespace("billing")
+	<-done
+	<-done
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxCallerBuckets bounds how many buckets a per-caller limit tracks;
+	// past it, refilled buckets are forgotten, then the least recently used.
+	maxCallerBuckets = 1024
+	// maxTokenBuckets bounds how many caller tokens of one uid get buckets of
+	// their own; further tokens share the uid's bucket.
+	maxTokenBuckets = 8
+
+	tokenKeySeparator = "/token:"
+)
+
+// WithRateLimit limits how often the job runs, whoever asks: bursts of up to
+// burst runs, then one run every interval. Runs over the limit end with
+// status base.RATE_LIMITED and say when to retry.
+func WithRateLimit(interval time.Duration, burst int) JobOption {
+	return func(j *notifyJob) {
+		j.rateLimit = newRateLimiter(interval, burst)
+	}
+}
+
+// WithCallerRateLimit limits how often each caller may run the job, like
+// WithRateLimit but with a bucket per caller. Callers are told apart by the
+// peer uid, and callers of one uid further by the token they send (see
+// client.WithCallerToken). Tokens are not verified, so a uid gets at most 8
+// token buckets and its other tokens share the uid's bucket. Callers without
+// a known uid share one bucket, split by token in the same way.
+func WithCallerRateLimit(interval time.Duration, burst int) JobOption {
+	return func(j *notifyJob) {
+		j.callerRateLimit = newRateLimiter(interval, burst)
+	}
+}
+
+// rateLimiter keeps a token bucket per key.
+type rateLimiter struct {
+	interval time.Duration
+	burst    float64
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	// tokenBuckets counts the token buckets of each uid key.
+	tokenBuckets map[string]int
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	// owner is the uid key of a token bucket, empty for other buckets.
+	owner string
+}
+
+func newRateLimiter(interval time.Duration, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{interval: interval, burst: float64(burst), buckets: make(map[string]*tokenBucket), tokenBuckets: make(map[string]int)}
+}
+
+// take spends a token of key, or reports how long until one is available.
+func (l *rateLimiter) take(key string, now time.Time) (time.Duration, bool) {
+	if l.interval <= 0 {
+		return 0, true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	bucket := l.bucketLocked(key, now)
+	l.refill(bucket, now)
+	if bucket.tokens < 1 {
+		return time.Duration((1 - bucket.tokens) * float64(l.interval)), false
+	}
+	bucket.tokens--
+	return 0, true
+}
+
+// bucketLocked finds or creates the bucket of key. A key naming a token of a
+// uid that already has maxTokenBuckets token buckets gets the uid's bucket.
+func (l *rateLimiter) bucketLocked(key string, now time.Time) *tokenBucket {
+	if bucket, ok := l.buckets[key]; ok {
+		return bucket
+	}
+	owner, _, isToken := strings.Cut(key, tokenKeySeparator)
+	if isToken && l.tokenBuckets[owner] >= maxTokenBuckets {
+		return l.bucketLocked(owner, now)
+	}
+	if len(l.buckets) >= maxCallerBuckets {
+		l.forgetLocked(now)
+	}
+	bucket := &tokenBucket{tokens: l.burst, last: now}
+	if isToken {
+		bucket.owner = owner
+		l.tokenBuckets[owner]++
+	}
+	l.buckets[key] = bucket
+	return bucket
+}
+
+// refund gives back a token spent by take.
+func (l *rateLimiter) refund(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	bucket, ok := l.buckets[key]
+	if !ok {
+		owner, _, _ := strings.Cut(key, tokenKeySeparator)
+		bucket, ok = l.buckets[owner]
+	}
+	if ok {
+		bucket.tokens = math.Min(bucket.tokens+1, l.burst)
+	}
+}
+
+func (l *rateLimiter) refill(bucket *tokenBucket, now time.Time) {
+	if elapsed := now.Sub(bucket.last); elapsed > 0 {
+		bucket.tokens = math.Min(bucket.tokens+float64(elapsed)/float64(l.interval), l.burst)
+		bucket.last = now
+	}
+}
+
+// forgetLocked drops the buckets that have refilled, and when that frees
+// nothing the least recently used one, so the map stays bounded.
+func (l *rateLimiter) forgetLocked(now time.Time) {
+	var oldest string
+	for key, bucket := range l.buckets {
+		if bucket.tokens+float64(now.Sub(bucket.last))/float64(l.interval) >= l.burst {
+			l.deleteLocked(key, bucket)
+		} else if oldest == "" || bucket.last.Before(l.buckets[oldest].last) {
+			oldest = key
+		}
+	}
+	if len(l.buckets) >= maxCallerBuckets && oldest != "" {
+		l.deleteLocked(oldest, l.buckets[oldest])
+	}
+}
+
+func (l *rateLimiter) deleteLocked(key string, bucket *tokenBucket) {
+	delete(l.buckets, key)
+	if bucket.owner == "" {
+		return
+	}
+	if l.tokenBuckets[bucket.owner]--; l.tokenBuckets[bucket.owner] <= 0 {
+		delete(l.tokenBuckets, bucket.owner)
+	}
+}
+
+// rateKey names the bucket of caller in per-caller limits: its verified
+// peer uid, split by the token it sends.
+func (c Caller) rateKey() string {
+	owner := "unknown"
+	if c.Known {
+		owner = fmt.Sprintf("uid:%d", c.UID)
+	}
+	if c.Token == "" {
+		return owner
+	}
+	return owner + tokenKeySeparator + c.Token
+}
+
+// admit spends a token of every limit of job that applies to caller, or
+// reports how long until the run would be admitted.
+func (j *notifyJob) admit(caller Caller) (time.Duration, bool) {
+	now := time.Now()
+	key := caller.rateKey()
+	if j.callerRateLimit != nil {
+		if wait, ok := j.callerRateLimit.take(key, now); !ok {
+			return wait, false
+		}
+	}
+	if j.rateLimit != nil {
+		if wait, ok := j.rateLimit.take("", now); !ok {
+			if j.callerRateLimit != nil {
+				j.callerRateLimit.refund(key)
+			}
+			return wait, false
+		}
+	}
+	return 0, true
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+	"github.com/Kingson4Wu/saturncli/utils"
+)
+
+func TestRateLimiterBuckets(t *testing.T) {
+	limiter := newRateLimiter(100*time.Millisecond, 2)
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		if _, ok := limiter.take("a", now); !ok {
+			t.Fatalf("take %d should fit in the burst", i+1)
+		}
+	}
+	if wait, ok := limiter.take("a", now); ok || wait != 100*time.Millisecond {
+		t.Fatalf("expected a 100ms wait, got %v %v", wait, ok)
+	}
+	if _, ok := limiter.take("b", now); !ok {
+		t.Fatal("keys should have their own buckets")
+	}
+	if wait, ok := limiter.take("a", now.Add(75*time.Millisecond)); ok || wait != 25*time.Millisecond {
+		t.Fatalf("expected a 25ms wait after a partial refill, got %v %v", wait, ok)
+	}
+	if _, ok := limiter.take("a", now.Add(100*time.Millisecond)); !ok {
+		t.Fatal("a token should be back after the interval")
+	}
+}
+
+func TestJobRateLimits(t *testing.T) {
+	job := &notifyJob{name: "report"}
+	WithRateLimit(time.Hour, 2)(job)
+	WithCallerRateLimit(time.Hour, 1)(job)
+	alice, bob, carol := Caller{Token: "alice"}, Caller{UID: 1000, Known: true}, Caller{UID: 1001, Known: true}
+	if _, ok := job.admit(alice); !ok {
+		t.Fatal("alice's first run should be admitted")
+	}
+	if _, ok := job.admit(alice); ok {
+		t.Fatal("alice's second run should hit her limit")
+	}
+	if _, ok := job.admit(bob); !ok {
+		t.Fatal("bob's first run should be admitted")
+	}
+	if wait, ok := job.admit(carol); ok || wait <= 0 {
+		t.Fatalf("carol's run should hit the job limit, got %v %v", wait, ok)
+	}
+	if bucket := job.callerRateLimit.buckets[carol.rateKey()]; bucket.tokens != 1 {
+		t.Fatalf("carol's token should be refunded when the job limit refuses, got %v", bucket.tokens)
+	}
+}
+
+func TestCallerTokensStayWithinTheirUID(t *testing.T) {
+	job := &notifyJob{name: "report"}
+	WithCallerRateLimit(time.Hour, 1)(job)
+	for i := 0; i < maxTokenBuckets; i++ {
+		if _, ok := job.admit(Caller{UID: 1000, Known: true, Token: fmt.Sprintf("t%d", i)}); !ok {
+			t.Fatalf("token %d should get a bucket of its own", i)
+		}
+	}
+	if _, ok := job.admit(Caller{UID: 1000, Known: true, Token: "spare"}); !ok {
+		t.Fatal("a further token should get the uid's bucket")
+	}
+	if _, ok := job.admit(Caller{UID: 1000, Known: true, Token: "rotated"}); ok {
+		t.Fatal("rotating tokens should not escape the uid's limit")
+	}
+	if _, ok := job.admit(Caller{UID: 1001, Known: true, Token: "t0"}); !ok {
+		t.Fatal("the same token of another uid should have its own bucket")
+	}
+}
+
+func TestRateLimiterStaysBounded(t *testing.T) {
+	limiter := newRateLimiter(time.Hour, 1)
+	now := time.Now()
+	for i := 0; i <= maxCallerBuckets; i++ {
+		limiter.take(fmt.Sprintf("uid:%d", i), now.Add(time.Duration(i)))
+	}
+	if n := len(limiter.buckets); n > maxCallerBuckets {
+		t.Fatalf("expected at most %d buckets, got %d", maxCallerBuckets, n)
+	}
+	if _, ok := limiter.buckets["uid:0"]; ok {
+		t.Fatal("the least recently used bucket should be forgotten")
+	}
+}
+
+func TestRateLimitedReply(t *testing.T) {
+	registry := NewRegistry()
+	if err := registry.AddJob("report", func(map[string]string, string) bool { return true }, WithCallerRateLimit(time.Hour, 1)); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry))
+	run := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/report", nil)
+		req.Header.Set(base.CallerToken, token)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+	if rec := run("alice"); rec.Code != http.StatusOK || rec.Body.String() != base.SUCCESS {
+		t.Fatalf("first run should succeed, got %d %s", rec.Code, rec.Body.String())
+	}
+	rec := run("alice")
+	if rec.Code != http.StatusTooManyRequests || rec.Body.String() != base.RATE_LIMITED || rec.Header().Get("Retry-After") != "3600" {
+		t.Fatalf("expected 429 with Retry-After, got %d %s %q", rec.Code, rec.Body.String(), rec.Header().Get("Retry-After"))
+	}
+	if rec := run("bob"); rec.Code != http.StatusOK {
+		t.Fatalf("another caller should not be limited, got %d %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sync"
+
+	"github.com/Kingson4Wu/saturncli/base"
+)
+
+// RequestJobHandler handles jobs registered with AddRequestJob and returns
+// true on success. Such jobs are stoppable: implementations should watch
+// JobRequest.Quit and return promptly once it is closed.
+type RequestJobHandler func(*JobRequest) bool
+
+// JobRequest describes a single run of a job registered with AddRequestJob.
+type JobRequest struct {
+	// Name is the registered job name.
+	Name string
+	// Signature identifies this run; it is what stop requests target.
+	Signature string
+	// Args holds the query parameters, first value per key.
+	Args map[string]string
+	// Values holds every query parameter value, in the order they were sent.
+	Values url.Values
+	// Payload is the raw request body, nil when the caller sent none.
+	Payload []byte
+	// ContentType is the media type the caller declared for Payload.
+	ContentType string
+	// Resumed is true when this run continues an earlier run with the same
+	// signature; Checkpoint then returns where that run left off.
+	Resumed bool
+
+	quit        chan struct{}
+	pause       *pauseState
+	run         *activeRun
+	publish     func(base.Event)
+	checkpoints CheckpointStore
+	// caller started the run; workflow steps run as it.
+	caller *Caller
+
+	resultMu   sync.Mutex
+	result     json.RawMessage
+	resultType string
+	outputs    map[string]string
+}
+
+// Quit is closed when a stop is requested for this run.
+func (r *JobRequest) Quit() <-chan struct{} {
+	return r.quit
+}
+
+// StopReason is the reason given by the request that stopped this run, empty
+// until Quit is closed or when the stop gave none.
+func (r *JobRequest) StopReason() string {
+	if r.run == nil {
+		return ""
+	}
+	return r.run.stopReason()
+}
+
+// Paused reports whether a pause was requested and not yet resumed.
+func (r *JobRequest) Paused() bool {
+	return r.pause.paused()
+}
+
+// WaitIfPaused blocks while the run is paused and returns false if the run
+// was stopped meanwhile. Call it between units of work: the run only pauses
+// where the handler checks, so progress made so far is kept.
+func (r *JobRequest) WaitIfPaused() bool {
+	return r.pause.wait(r.quit)
+}
+
+// Checkpoint returns the cursor last saved for this run, or nil when none
+// was saved. Checkpoints are deleted once the run succeeds.
+func (r *JobRequest) Checkpoint() ([]byte, error) {
+	if r.checkpoints == nil {
+		return nil, ErrNoCheckpointStore
+	}
+	cursor, _, err := r.checkpoints.Load(r.Name, r.Signature)
+	return cursor, err
+}
+
+// SaveCheckpoint records how far the run got. If the run is interrupted,
+// for example by a restart, it can be resumed with its signature and the
+// handler picks up from Checkpoint.
+func (r *JobRequest) SaveCheckpoint(cursor []byte) error {
+	if r.checkpoints == nil {
+		return ErrNoCheckpointStore
+	}
+	return r.checkpoints.Save(r.Name, r.Signature, cursor)
+}
+
+// Get returns the first value of key, or "" when it was not sent.
+func (r *JobRequest) Get(key string) string {
+	return r.Values.Get(key)
+}
+
+// All returns every value sent for key, in order.
+func (r *JobRequest) All(key string) []string {
+	return r.Values[key]
+}
+
+// Has reports whether key was sent at all.
+func (r *JobRequest) Has(key string) bool {
+	return r.Values.Has(key)
+}
+
+// SetResult records the value returned to the caller. Strings are returned
+// as text, byte slices as raw bytes and anything else as JSON, so v must be
+// JSON-serializable. Calling it again replaces the previous value.
+func (r *JobRequest) SetResult(v any) error {
+	var resultType string
+	switch v.(type) {
+	case nil:
+		r.resultMu.Lock()
+		r.result, r.resultType = nil, ""
+		r.resultMu.Unlock()
+		return nil
+	case string:
+		resultType = base.ResultText
+	case []byte:
+		resultType = base.ResultBytes
+	default:
+		resultType = base.ResultJSON
+	}
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode job result: %w", err)
+	}
+	r.resultMu.Lock()
+	r.result, r.resultType = encoded, resultType
+	r.resultMu.Unlock()
+	return nil
+}
+
+// SetOutput records a named output value returned to the caller alongside
+// the result. It is safe to call from several goroutines.
+func (r *JobRequest) SetOutput(key, value string) {
+	r.resultMu.Lock()
+	defer r.resultMu.Unlock()
+	if r.outputs == nil {
+		r.outputs = make(map[string]string)
+	}
+	r.outputs[key] = value
+}
+
+// fillResponse copies the recorded result and outputs into resp.
+func (r *JobRequest) fillResponse(resp *base.Response) {
+	r.resultMu.Lock()
+	defer r.resultMu.Unlock()
+	resp.Result, resp.ResultType = r.result, r.resultType
+	if len(r.outputs) > 0 {
+		resp.Outputs = make(map[string]string, len(r.outputs))
+		for k, v := range r.outputs {
+			resp.Outputs[k] = v
+		}
+	}
+}
+
+// ReportProgress publishes a progress event for this run. percent is
+// optional context for observers; pass 0 when it is unknown.
+func (r *JobRequest) ReportProgress(percent float64, message string) {
+	if r.publish == nil {
+		return
+	}
+	r.publish(base.Event{Type: base.EventProgress, Job: r.Name, Signature: r.Signature, Percent: percent, Message: message})
+}
+
+// DecodePayload unmarshals a JSON payload into v.
+func (r *JobRequest) DecodePayload(v any) error {
+	if len(r.Payload) == 0 {
+		return errors.New("request has no payload")
+	}
+	return json.Unmarshal(r.Payload, v)
+}
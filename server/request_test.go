@@ -0,0 +1,105 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Kingson4Wu/saturncli/base"
+	"github.com/Kingson4Wu/saturncli/utils"
+)
+
+// serveJSON sends req to srv asking for the JSON envelope and decodes the reply.
+func serveJSON(t *testing.T, srv http.Handler, req *http.Request) base.Response {
+	t.Helper()
+	return decodeReply(t, record(srv, req))
+}
+
+// serveAsync is serveJSON for runs that block: it serves req from a new
+// goroutine, and the test decodes the delivered reply with decodeReply.
+func serveAsync(srv http.Handler, req *http.Request) <-chan *httptest.ResponseRecorder {
+	done := make(chan *httptest.ResponseRecorder, 1)
+	go func() {
+		done <- record(srv, req)
+	}()
+	return done
+}
+
+func record(srv http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	req.Header.Set("Accept", base.JSONContentType)
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	return rec
+}
+
+// decodeReply decodes the JSON envelope recorded by rec.
+func decodeReply(t *testing.T, rec *httptest.ResponseRecorder) base.Response {
+	t.Helper()
+	var resp base.Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode reply %q: %v", rec.Body.String(), err)
+	}
+	return resp
+}
+
+func TestJobRequestResult(t *testing.T) {
+	registry := NewRegistry()
+	if err := registry.AddRequestJob("count", func(req *JobRequest) bool {
+		if err := req.SetResult(map[string]int{"orphans": 42}); err != nil {
+			return false
+		}
+		req.SetOutput("table", req.Get("table"))
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	if err := registry.AddRequestJob("text", func(req *JobRequest) bool {
+		_ = req.SetResult("dry run: 3 statements")
+		return false
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	if err := registry.AddRequestJob("bytes", func(req *JobRequest) bool {
+		return req.SetResult([]byte{0, 1, 2}) == nil
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry))
+
+	resp := serveJSON(t, srv, httptest.NewRequest(http.MethodGet, "/count?table=users", nil))
+	if resp.Status != base.SUCCESS || resp.ResultType != base.ResultJSON || string(resp.Result) != `{"orphans":42}` {
+		t.Fatalf("unexpected json result: %+v", resp)
+	}
+	if resp.Outputs["table"] != "users" {
+		t.Fatalf("unexpected outputs: %v", resp.Outputs)
+	}
+
+	resp = serveJSON(t, srv, httptest.NewRequest(http.MethodGet, "/text", nil))
+	if resp.Status != base.FAILURE || resp.ResultType != base.ResultText || string(resp.Result) != `"dry run: 3 statements"` {
+		t.Fatalf("a failing run should still carry its result: %+v", resp)
+	}
+
+	resp = serveJSON(t, srv, httptest.NewRequest(http.MethodGet, "/bytes", nil))
+	if resp.ResultType != base.ResultBytes || string(resp.Result) != `"AAEC"` {
+		t.Fatalf("unexpected bytes result: %+v", resp)
+	}
+
+	history := registry.History("count")
+	if len(history) != 1 || string(history[0].Result) != `{"orphans":42}` || history[0].Args["table"] != "users" {
+		t.Fatalf("result not recorded in history: %+v", history)
+	}
+	if all := registry.History(""); len(all) != 3 || all[0].Job != "bytes" {
+		t.Fatalf("expected newest-first history of every job, got %+v", all)
+	}
+}
+
+func TestHistoryIsBounded(t *testing.T) {
+	registry := NewRegistry()
+	for i := 0; i < historySize+5; i++ {
+		registry.record(base.RunRecord{Response: base.Response{Job: "x", Signature: string(rune('a' + i%26))}})
+	}
+	if got := len(registry.History("")); got != historySize {
+		t.Fatalf("expected %d records, got %d", historySize, got)
+	}
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+)
+
+// activeRun is a run in flight, as tracked by the registry. It stays tracked
+// until its handler returns or a forced stop abandons it.
+type activeRun struct {
+	// quit is nil for runs of jobs that cannot be stopped.
+	quit     chan struct{}
+	pause    *pauseState
+	pausable bool
+	// args and caller are what the run was started with, for stop filters.
+	args   map[string]string
+	caller Caller
+	// ended is closed when the run is no longer tracked.
+	ended chan struct{}
+	// gone is closed when a forced stop abandons the run.
+	gone chan struct{}
+
+	mu       sync.Mutex
+	stopping bool
+	reason   string
+	returned bool
+	// startedAt is when the run was accepted while queued, then when it
+	// started.
+	startedAt time.Time
+	queued    bool
+}
+
+// start marks a queued run as started at t.
+func (a *activeRun) start(t time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.startedAt, a.queued = t, false
+}
+
+// started reports when the run started, or was queued, and whether it is
+// still queued.
+func (a *activeRun) started() (time.Time, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.startedAt, a.queued
+}
+
+// pauseState is the cooperative pause switch of one run. The handler honours
+// it by calling JobRequest.WaitIfPaused at points where it can safely yield.
+type pauseState struct {
+	mu      sync.Mutex
+	resumed chan struct{} // non-nil while paused, closed on resume
+}
+
+func (p *pauseState) pause() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.resumed != nil {
+		return false
+	}
+	p.resumed = make(chan struct{})
+	return true
+}
+
+func (p *pauseState) resume() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.resumed == nil {
+		return false
+	}
+	close(p.resumed)
+	p.resumed = nil
+	return true
+}
+
+func (p *pauseState) paused() bool {
+	if p == nil {
+		return false
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.resumed != nil
+}
+
+// wait blocks while paused and reports false if quit closed first.
+func (p *pauseState) wait(quit <-chan struct{}) bool {
+	if p == nil {
+		return !isClosed(quit)
+	}
+	p.mu.Lock()
+	resumed := p.resumed
+	p.mu.Unlock()
+	if resumed == nil {
+		return !isClosed(quit)
+	}
+	select {
+	case <-resumed:
+		return !isClosed(quit)
+	case <-quit:
+		return false
+	}
+}
+
+// Runs lists the runs in flight, queued ones included, oldest first. An
+// empty name lists runs of every job.
+func (r *Registry) Runs(name string) []base.RunInfo {
+	r.runningMu.RLock()
+	names := make([]string, 0, len(r.running))
+	for jobName := range r.running {
+		if name == "" || jobName == name {
+			names = append(names, jobName)
+		}
+	}
+	r.runningMu.RUnlock()
+
+	runs := []base.RunInfo{}
+	for _, jobName := range names {
+		r.runningMap(jobName).Range(func(key, value any) bool {
+			signature, _ := key.(string)
+			if run, ok := value.(*activeRun); ok {
+				startedAt, queued := run.started()
+				state := base.RunRunning
+				switch {
+				case run.isStopping():
+					state = base.RunStopping
+				case run.pause.paused():
+					state = base.RunPaused
+				case queued:
+					state = base.RunQueued
+				}
+				runs = append(runs, base.RunInfo{Job: jobName, Signature: signature, State: state, Pausable: run.pausable, StartedAt: startedAt, Stoppable: run.quit != nil})
+			}
+			return true
+		})
+	}
+	sort.Slice(runs, func(i, j int) bool {
+		if !runs[i].StartedAt.Equal(runs[j].StartedAt) {
+			return runs[i].StartedAt.Before(runs[j].StartedAt)
+		}
+		return runs[i].Signature < runs[j].Signature
+	})
+	return runs
+}
+
+// Pause asks a run to yield at its next WaitIfPaused call. It reports false
+// when no pausable run matches or the run is already paused.
+func (r *Registry) Pause(jobName, signature string) bool {
+	run, ok := r.activeRun(jobName, signature)
+	if !ok || !run.pausable || !run.pause.pause() {
+		return false
+	}
+	r.publish(base.Event{Type: base.EventPaused, Job: jobName, Signature: signature})
+	return true
+}
+
+// Resume lets a paused run continue. It reports false when no paused run matches.
+func (r *Registry) Resume(jobName, signature string) bool {
+	run, ok := r.activeRun(jobName, signature)
+	if !ok || !run.pause.resume() {
+		return false
+	}
+	r.publish(base.Event{Type: base.EventResumed, Job: jobName, Signature: signature})
+	return true
+}
+
+// controlRun serves PausePath and ResumePath for the run named by the job and
+// signature query parameters.
+func (s *ser) controlRun(rw http.ResponseWriter, r *http.Request, pause bool) {
+	query := r.URL.Query()
+	name, signature := query.Get("job"), query.Get("signature")
+	if !s.authorize(rw, r, name) {
+		return
+	}
+	resp := base.Response{Job: name, Signature: signature}
+	run, ok := s.registry.activeRun(name, signature)
+	switch {
+	case !ok:
+		resp.Status, resp.Message = base.NOT_EXIST, "no running instance matched"
+		s.reply(rw, r, http.StatusNotFound, resp)
+		return
+	case !run.pausable:
+		resp.Status, resp.Message = base.FAILURE, "job is not pausable"
+		s.reply(rw, r, http.StatusConflict, resp)
+		return
+	}
+
+	action, done, state := "resume", false, base.RunRunning
+	if pause {
+		action, done, state = "pause", s.registry.Pause(name, signature), base.RunPaused
+	} else {
+		done = s.registry.Resume(name, signature)
+	}
+	if !done {
+		resp.Status, resp.Message = base.FAILURE, "run is already "+state
+		s.reply(rw, r, http.StatusConflict, resp)
+		return
+	}
+	resp.Status = base.SUCCESS
+	s.reply(rw, r, http.StatusOK, resp)
+	s.logger.Infof("saturn server job %s success, name:%s, signature: %s", action, name, signature)
+}
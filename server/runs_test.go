@@ -0,0 +1,119 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+	"github.com/Kingson4Wu/saturncli/utils"
+)
+
+func TestPauseAndResume(t *testing.T) {
+	registry := NewRegistry()
+	processed := make(chan int, 10)
+	if err := registry.AddRequestJob("backfill", func(req *JobRequest) bool {
+		for i := 0; i < 3; i++ {
+			if !req.WaitIfPaused() {
+				return false
+			}
+			processed <- i
+			time.Sleep(20 * time.Millisecond)
+		}
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	if err := registry.AddStoppableJob("legacy", func(args map[string]string, signature string, quit chan struct{}) bool {
+		<-quit
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry))
+	done := map[string]<-chan *httptest.ResponseRecorder{}
+	for _, job := range []string{"backfill", "legacy"} {
+		req := httptest.NewRequest(http.MethodGet, "/"+job, nil)
+		req.Header.Set(base.RunSignature, job+"-1")
+		done[job] = serveAsync(srv, req)
+	}
+	<-processed
+	for deadline := time.Now().Add(time.Second); len(registry.Runs("")) < 2; {
+		if time.Now().After(deadline) {
+			t.Fatal("runs were not tracked")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	control := func(path, job string) base.Response {
+		return serveJSON(t, srv, httptest.NewRequest(http.MethodPost, path+"?job="+job+"&signature="+job+"-1", nil))
+	}
+	if resp := control(base.PausePath, "backfill"); resp.Status != base.SUCCESS {
+		t.Fatalf("pause failed: %+v", resp)
+	}
+	if resp := control(base.PausePath, "backfill"); resp.Status != base.FAILURE {
+		t.Fatalf("second pause should fail: %+v", resp)
+	}
+	if resp := control(base.PausePath, "legacy"); resp.Status != base.FAILURE || resp.Message != "job is not pausable" {
+		t.Fatalf("stoppable handlers cannot pause: %+v", resp)
+	}
+	if runs := registry.Runs("backfill"); len(runs) != 1 || runs[0].State != base.RunPaused || !runs[0].Pausable {
+		t.Fatalf("expected the backfill to show as paused, got %+v", runs)
+	}
+
+	// an item already past its checkpoint may finish, then the handler waits
+	time.Sleep(50 * time.Millisecond)
+	for len(processed) > 0 {
+		<-processed
+	}
+	select {
+	case i := <-processed:
+		t.Fatalf("item %d processed while paused", i)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if resp := control(base.ResumePath, "backfill"); resp.Status != base.SUCCESS {
+		t.Fatalf("resume failed: %+v", resp)
+	}
+	if resp := decodeReply(t, <-done["backfill"]); resp.Status != base.SUCCESS || resp.Job != "backfill" {
+		t.Fatalf("unexpected backfill reply: %+v", resp)
+	}
+	registry.stopAll("legacy")
+	<-done["legacy"]
+	if resp := control(base.ResumePath, "backfill"); resp.Status != base.NOT_EXIST {
+		t.Fatalf("finished runs cannot be resumed: %+v", resp)
+	}
+}
+
+func TestStopWhilePaused(t *testing.T) {
+	registry := NewRegistry()
+	started := make(chan struct{})
+	if err := registry.AddRequestJob("backfill", func(req *JobRequest) bool {
+		close(started)
+		for !req.Paused() {
+			time.Sleep(time.Millisecond)
+		}
+		return req.WaitIfPaused()
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry))
+	req := httptest.NewRequest(http.MethodGet, "/backfill", nil)
+	req.Header.Set(base.RunSignature, "s1")
+	done := serveAsync(srv, req)
+	<-started
+	if !registry.Pause("backfill", "s1") {
+		t.Fatal("pause failed")
+	}
+	registry.stopSpecific("backfill", "s1")
+	select {
+	case rec := <-done:
+		if resp := decodeReply(t, rec); resp.Status != base.INTERRUPT {
+			t.Fatalf("expected interrupt, got %+v", resp)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("paused run did not stop")
+	}
+}
@@ -20,7 +20,8 @@ func (s *ser) Serve() {
 		s.logger.Warnf("Failed to remove existing socket file: %v", err)
 	}
 	server := http.Server{
-		Handler: s,
+		Handler:     s,
+		ConnContext: connContext,
 	}
 	unixListener, err := net.Listen("unix", sockPath)
 	if err != nil {
@@ -10,8 +10,9 @@ import (
 func (s *ser) Serve() {
 	s.logger.Info("saturn server Http Serve ...")
 	server := http.Server{
-		Addr:    fmt.Sprintf("127.0.0.1:%s", "8096"),
-		Handler: s,
+		Addr:        fmt.Sprintf("127.0.0.1:%s", "8096"),
+		Handler:     s,
+		ConnContext: connContext,
 	}
 	server.ListenAndServe()
 
@@ -0,0 +1,382 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+	"github.com/Kingson4Wu/saturncli/utils"
+)
+
+// StopError is the cause of the context of a ContextJobHandler run that was
+// stopped, as returned by context.Cause.
+type StopError struct {
+	// Reason is the reason given by the stop, empty when it gave none.
+	Reason string
+}
+
+func (e *StopError) Error() string {
+	if e.Reason == "" {
+		return "run was stopped"
+	}
+	return "run was stopped: " + e.Reason
+}
+
+// StopReason returns the reason given by the stop of the run of job name
+// with signature, so that a StoppableJobHandler can read it once its quit
+// channel is closed. It is empty while the run is not stopping, when the stop
+// gave no reason, or once the run has ended.
+func (r *Registry) StopReason(name, signature string) string {
+	run, ok := r.activeRun(name, signature)
+	if !ok {
+		return ""
+	}
+	return run.stopReason()
+}
+
+// requestStop closes the run's quit channel, giving reason. It reports
+// false when the run was already asked to stop, the first reason being kept,
+// or cannot be stopped.
+func (a *activeRun) requestStop(reason string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.stopping || a.quit == nil {
+		return false
+	}
+	a.stopping, a.reason = true, reason
+	return safeCloseQuit(a.quit)
+}
+
+func (a *activeRun) stopReason() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.reason
+}
+
+func (a *activeRun) isStopping() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.stopping
+}
+
+// abandon gives up on a run whose handler has not returned. It reports false
+// when the handler returned first.
+func (a *activeRun) abandon() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.returned {
+		return false
+	}
+	if !isClosed(a.gone) {
+		close(a.gone)
+	}
+	return true
+}
+
+// handlerReturned marks the handler as returned. It reports false when the
+// run was abandoned first.
+func (a *activeRun) handlerReturned() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if isClosed(a.gone) {
+		return false
+	}
+	a.returned = true
+	return true
+}
+
+// handlerPanic carries a panic of a handler run by awaitHandler, with the
+// stack of the goroutine it happened on.
+type handlerPanic struct {
+	value any
+	stack []byte
+}
+
+// awaitHandler calls handle on its own goroutine so that a forced stop can
+// give up on it, and reports false if one did; abandoned, when set, is then
+// called once the handler does return. A panic in handle is raised again on
+// the calling goroutine as a handlerPanic.
+func awaitHandler(run *activeRun, handle func() bool, abandoned func()) (bool, bool) {
+	type outcome struct {
+		result bool
+		panic  *handlerPanic
+	}
+	returned := make(chan outcome, 1)
+	go func() {
+		var out outcome
+		defer func() {
+			if err := recover(); err != nil {
+				out.panic = &handlerPanic{value: err, stack: utils.Stack(3)}
+			}
+			if run.handlerReturned() {
+				returned <- out
+			} else if abandoned != nil {
+				abandoned()
+			}
+		}()
+		out.result = handle()
+	}()
+	select {
+	case out := <-returned:
+		if out.panic != nil {
+			panic(*out.panic)
+		}
+		return out.result, true
+	case <-run.gone:
+		return false, false
+	}
+}
+
+// askToStop asks the runs of jobName to stop, the one with signature or every
+// one when signature is empty, and returns them, including runs that were
+// already asked.
+func (r *Registry) askToStop(jobName, signature, reason string) []*activeRun {
+	signatures := []string{signature}
+	if signature == "" {
+		signatures = r.runningSignatures(jobName)
+	}
+	var runs []*activeRun
+	for _, signature := range signatures {
+		run, ok := r.activeRun(jobName, signature)
+		if !ok {
+			continue
+		}
+		if run.requestStop(reason) {
+			r.publish(base.Event{Type: base.EventStopRequested, Job: jobName, Signature: signature, Message: reason})
+		}
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+// StopFilter selects runs in flight. A run must match every field that is
+// set.
+type StopFilter struct {
+	// Job is a job name or a pattern such as "billing.*".
+	Job string
+	// Caller is the token the caller sent, or its uid.
+	Caller string
+	// OlderThan matches runs started longer ago than this.
+	OlderThan time.Duration
+	// Params matches runs started with these parameter values.
+	Params map[string]string
+}
+
+func (f StopFilter) empty() bool {
+	return f.Job == "" && f.Caller == "" && f.OlderThan <= 0 && len(f.Params) == 0
+}
+
+func (f StopFilter) matches(job string, run *activeRun, now time.Time) bool {
+	if !matchJobName(f.Job, job) {
+		return false
+	}
+	if f.Caller != "" && f.Caller != run.caller.Token && !(run.caller.Known && f.Caller == strconv.Itoa(run.caller.UID)) {
+		return false
+	}
+	if startedAt, _ := run.started(); f.OlderThan > 0 && now.Sub(startedAt) < f.OlderThan {
+		return false
+	}
+	for key, value := range f.Params {
+		if actual, ok := run.args[key]; !ok || actual != value {
+			return false
+		}
+	}
+	return true
+}
+
+// StopMatching asks every run in flight that matches filter to stop, giving
+// reason, and returns how many were asked. An empty filter matches every run.
+func (r *Registry) StopMatching(filter StopFilter, reason string) int {
+	now := time.Now()
+	return r.stopWhere(func(job string, run *activeRun) bool {
+		return filter.matches(job, run, now)
+	}, reason)
+}
+
+// stopWhere asks the runs in flight for which match holds to stop and
+// returns how many were asked.
+func (r *Registry) stopWhere(match func(job string, run *activeRun) bool, reason string) int {
+	r.runningMu.RLock()
+	names := make([]string, 0, len(r.running))
+	for name := range r.running {
+		names = append(names, name)
+	}
+	r.runningMu.RUnlock()
+
+	stopped := 0
+	for _, name := range names {
+		r.runningMap(name).Range(func(key, value any) bool {
+			signature, _ := key.(string)
+			if run, ok := value.(*activeRun); ok && match(name, run) && run.requestStop(reason) {
+				r.publish(base.Event{Type: base.EventStopRequested, Job: name, Signature: signature, Message: reason})
+				stopped++
+			}
+			return true
+		})
+	}
+	return stopped
+}
+
+// stopMatching stops the runs matching filter in the server's registry and
+// in its mounts, leaving alone runs of jobs the caller may not use.
+func (s *ser) stopMatching(filter StopFilter, caller Caller, reason string) int {
+	now := time.Now()
+	stopped := s.registry.stopWhere(func(job string, run *activeRun) bool {
+		return filter.matches(job, run, now) && s.registry.allows(job, caller)
+	}, reason)
+	for _, m := range s.mountList() {
+		registry := m.server.registry
+		stopped += registry.stopWhere(func(job string, run *activeRun) bool {
+			qualified := m.prefix + base.NamespaceSeparator + job
+			return filter.matches(qualified, run, now) && s.registry.allows(qualified, caller) && registry.allows(job, caller)
+		}, reason)
+	}
+	return stopped
+}
+
+// stopFiltered serves StopPath: it stops the runs matching the job (a name
+// or pattern), namespace, caller, older_than and param (key=value, can be
+// repeated) query parameters, giving the reason parameter.
+func (s *ser) stopFiltered(rw http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := StopFilter{Job: query.Get("job"), Caller: query.Get("caller")}
+	resp := base.Response{Status: base.FAILURE, Job: filter.Job}
+	if namespace := strings.TrimSuffix(query.Get("namespace"), base.NamespaceSeparator+"*"); namespace != "" {
+		if validateJobName(namespace) != nil || filter.Job != "" {
+			resp.Job, resp.Message = namespace, "invalid namespace"
+			s.reply(rw, r, http.StatusBadRequest, resp)
+			return
+		}
+		// a name ending in the separator is checked against namespace and its parents
+		if !s.authorize(rw, r, namespace+base.NamespaceSeparator) {
+			return
+		}
+		filter.Job, resp.Job = namespace+base.NamespaceSeparator+"*", namespace
+	}
+	if value := query.Get("older_than"); value != "" {
+		var err error
+		if filter.OlderThan, err = time.ParseDuration(value); err != nil {
+			resp.Message = "invalid older_than " + value
+			s.reply(rw, r, http.StatusBadRequest, resp)
+			return
+		}
+	}
+	for _, param := range query["param"] {
+		key, value, ok := strings.Cut(param, "=")
+		if !ok {
+			resp.Message = "invalid param " + param + ", want key=value"
+			s.reply(rw, r, http.StatusBadRequest, resp)
+			return
+		}
+		if filter.Params == nil {
+			filter.Params = map[string]string{}
+		}
+		filter.Params[key] = value
+	}
+	if filter.empty() {
+		resp.Message = "a stop needs a job, namespace, caller, older_than or param filter"
+		s.reply(rw, r, http.StatusBadRequest, resp)
+		return
+	}
+
+	resp.Stopped = s.stopMatching(filter, callerOf(r), query.Get("reason"))
+	if resp.Stopped == 0 {
+		resp.Message = "no running instance matched"
+		s.logger.Errorf("saturn server filtered stop failure, filter: %+v", filter)
+	} else {
+		resp.Status, resp.Message = base.SUCCESS, fmt.Sprintf("%d runs asked to stop", resp.Stopped)
+		s.logger.Infof("saturn server filtered stop success, filter: %+v, runs: %d", filter, resp.Stopped)
+	}
+	s.reply(rw, r, http.StatusOK, resp)
+}
+
+// awaitStop waits up to wait for runs asked to stop to end and describes
+// where they ended up, with how many have not ended: RunStopping when not
+// waiting, RunStopped once every run ended, else RunUnresponsive. With force
+// the runs still going when the wait is over are abandoned instead.
+func awaitStop(runs []*activeRun, wait time.Duration, force bool) (string, int) {
+	expired := wait <= 0
+	var timeout <-chan time.Time
+	if !expired {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	pending, abandoned := 0, 0
+	for _, run := range runs {
+		if !expired {
+			select {
+			case <-run.ended:
+				continue
+			case <-timeout:
+				expired = true
+			}
+		}
+		switch {
+		case isClosed(run.ended):
+		case force && run.abandon():
+			abandoned++
+		default:
+			pending++
+		}
+	}
+	switch {
+	case pending > 0 && wait > 0:
+		return base.RunUnresponsive, pending
+	case pending > 0:
+		return base.RunStopping, pending
+	case abandoned > 0:
+		return base.RunAbandoned, 0
+	default:
+		return base.RunStopped, 0
+	}
+}
+
+func (s *ser) stopJob(rw http.ResponseWriter, r *http.Request, job *notifyJob) {
+	jobName := ""
+	if job != nil {
+		jobName = job.name
+	}
+	if job == nil || !job.isStoppable() {
+		s.reply(rw, r, http.StatusConflict, base.Response{Status: base.NOT_STOPPABLE, Job: jobName, Message: "job is not stoppable; its runs end only when their handler returns"})
+		s.logger.Errorf("saturn server job stop failure, job is not stoppable, name:%s", jobName)
+		return
+	}
+	name := job.name
+	signature := r.Header.Get(base.StopSignature)
+	resp := base.Response{Job: name, Signature: signature}
+	var wait time.Duration
+	if value := r.Header.Get(base.StopWait); value != "" {
+		var err error
+		if wait, err = time.ParseDuration(value); err != nil {
+			resp.Status, resp.Message = base.FAILURE, "invalid stop wait "+value
+			s.reply(rw, r, http.StatusBadRequest, resp)
+			return
+		}
+	}
+	force := r.Header.Get(base.StopForce) == "true"
+
+	runs := s.registry.askToStop(name, signature, r.Header.Get(base.StopReason))
+	if len(runs) == 0 {
+		resp.Status, resp.Message = base.FAILURE, "no running instance matched"
+		s.reply(rw, r, http.StatusOK, resp)
+		s.logger.Errorf("saturn server job stop failure, name:%s, signature: %s", name, signature)
+		return
+	}
+	state, pending := awaitStop(runs, wait, force)
+	resp.Status, resp.State = base.SUCCESS, state
+	switch state {
+	case base.RunUnresponsive:
+		resp.Status, resp.Message = base.FAILURE, fmt.Sprintf("%d of %d runs did not exit within %s", pending, len(runs), wait)
+		s.logger.Errorf("saturn server job stop failure, runs did not exit, name:%s, signature: %s, pending: %d", name, signature, pending)
+	case base.RunAbandoned:
+		resp.Message = "runs that did not exit were abandoned"
+		s.logger.Warnf("saturn server job stop abandoned runs, name:%s, signature: %s", name, signature)
+	default:
+		s.logger.Infof("saturn server job stop success, name:%s, signature: %s, state: %s", name, signature, state)
+	}
+	s.reply(rw, r, http.StatusOK, resp)
+}
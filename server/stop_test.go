@@ -0,0 +1,299 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+	"github.com/Kingson4Wu/saturncli/utils"
+)
+
+func TestStopWaitsForHandler(t *testing.T) {
+	registry := NewRegistry()
+	started, exit := make(chan struct{}), make(chan struct{})
+	if err := registry.AddStoppableJob("export", func(_ map[string]string, _ string, quit chan struct{}) bool {
+		close(started)
+		<-quit
+		<-exit
+		return false
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry))
+	req := httptest.NewRequest(http.MethodGet, "/export", nil)
+	req.Header.Set(base.RunSignature, "e-1")
+	done := serveAsync(srv, req)
+	<-started
+
+	stop := func(wait string) base.Response {
+		req := httptest.NewRequest(http.MethodGet, "/export", nil)
+		req.Header.Set(base.StopJobFlag, "true")
+		req.Header.Set(base.StopWait, wait)
+		return serveJSON(t, srv, req)
+	}
+	if resp := stop(""); resp.Status != base.SUCCESS || resp.State != base.RunStopping {
+		t.Fatalf("a stop without wait should report stopping, got %+v", resp)
+	}
+	if runs := registry.Runs("export"); len(runs) != 1 || runs[0].State != base.RunStopping {
+		t.Fatalf("the run should be listed as stopping until it exits, got %+v", runs)
+	}
+	if resp := stop("20ms"); resp.Status != base.FAILURE || resp.State != base.RunUnresponsive {
+		t.Fatalf("a run still going after the wait should be unresponsive, got %+v", resp)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		close(exit)
+	}()
+	if resp := stop("1s"); resp.Status != base.SUCCESS || resp.State != base.RunStopped {
+		t.Fatalf("the stop should confirm the run exited, got %+v", resp)
+	}
+	if resp := decodeReply(t, <-done); resp.Status != base.INTERRUPT {
+		t.Fatalf("the stopped run should be interrupted, got %+v", resp)
+	}
+	if resp := stop("1s"); resp.Status != base.FAILURE {
+		t.Fatalf("nothing should be left to stop, got %+v", resp)
+	}
+}
+
+func TestForcedStopAbandonsRun(t *testing.T) {
+	registry := NewRegistry()
+	started, exit := make(chan struct{}), make(chan struct{})
+	defer close(exit)
+	if err := registry.AddRequestJob("stuck", func(req *JobRequest) bool {
+		close(started)
+		<-exit
+		_ = req.SetResult("late")
+		return true
+	}, WithQueue("stuck")); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry))
+	events, cancel := registry.SubscribeChan()
+	defer cancel()
+	done := serveAsync(srv, httptest.NewRequest(http.MethodGet, "/stuck", nil))
+	<-started
+
+	req := httptest.NewRequest(http.MethodGet, "/stuck", nil)
+	req.Header.Set(base.StopJobFlag, "true")
+	req.Header.Set(base.StopWait, "20ms")
+	req.Header.Set(base.StopForce, "true")
+	if resp := serveJSON(t, srv, req); resp.Status != base.SUCCESS || resp.State != base.RunAbandoned {
+		t.Fatalf("a forced stop should abandon the run, got %+v", resp)
+	}
+	select {
+	case rec := <-done:
+		if resp := decodeReply(t, rec); resp.Status != base.ABANDONED || len(resp.Result) != 0 {
+			t.Fatalf("the run should end abandoned, got %+v", resp)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the abandoned run did not return")
+	}
+	for event := range events {
+		if event.Type == base.EventAbandoned {
+			break
+		}
+	}
+	if runs := registry.Runs("stuck"); len(runs) != 0 {
+		t.Fatalf("abandoned runs should not be listed, got %+v", runs)
+	}
+	if info := srv.queues.get("stuck").info(); info.Running != 0 {
+		t.Fatalf("the abandoned run should give back its queue worker, got %+v", info)
+	}
+}
+
+func TestStoppableHandlerPanic(t *testing.T) {
+	registry := NewRegistry()
+	if err := registry.AddStoppableJob("boom", func(map[string]string, string, chan struct{}) bool {
+		panic("boom")
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry))
+	if resp := serveJSON(t, srv, httptest.NewRequest(http.MethodGet, "/boom", nil)); resp.Status != base.FAILURE || resp.Message != "panic: boom" {
+		t.Fatalf("a panicking handler should fail the run, got %+v", resp)
+	}
+}
+
+func TestStopReasonsAndFilters(t *testing.T) {
+	registry := NewRegistry()
+	started, reasons := make(chan string, 3), make(chan string, 3)
+	if err := registry.AddRequestJob("reindex", func(req *JobRequest) bool {
+		started <- req.Signature
+		<-req.Quit()
+		reasons <- req.StopReason()
+		return false
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry))
+	done := map[string]<-chan *httptest.ResponseRecorder{}
+	for _, run := range []struct{ signature, tenant, token string }{{"r-1", "42", "ops"}, {"r-2", "42", "ci"}, {"r-3", "7", "ops"}} {
+		req := httptest.NewRequest(http.MethodGet, "/reindex?tenant="+run.tenant, nil)
+		req.Header.Set(base.RunSignature, run.signature)
+		req.Header.Set(base.CallerToken, run.token)
+		done[run.signature] = serveAsync(srv, req)
+		<-started
+	}
+
+	stop := func(query string) base.Response {
+		return serveJSON(t, srv, httptest.NewRequest(http.MethodPost, base.StopPath+"?"+query, nil))
+	}
+	if resp := stop("job=reindex&param=tenant%3D42&caller=ops&reason=incident"); resp.Status != base.SUCCESS || resp.Stopped != 1 {
+		t.Fatalf("the filters should match one run, got %+v", resp)
+	}
+	if reason := <-reasons; reason != "incident" {
+		t.Fatalf("the handler should get the stop reason, got %q", reason)
+	}
+	resp := decodeReply(t, <-done["r-1"])
+	if resp.Status != base.INTERRUPT || resp.StopReason != "incident" || resp.Message != "job was stopped: incident" {
+		t.Fatalf("unexpected reply of the stopped run: %+v", resp)
+	}
+	if history := registry.History("reindex"); len(history) != 1 || history[0].StopReason != "incident" {
+		t.Fatalf("the stop reason should be recorded, got %+v", history)
+	}
+
+	if resp := stop("job=re*&older_than=1h"); resp.Status != base.FAILURE || resp.Stopped != 0 {
+		t.Fatalf("no run is that old, got %+v", resp)
+	}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, base.StopPath+"?reason=everything", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("a stop without filters should be refused, got %d", rec.Code)
+	}
+	if resp := stop("param=tenant%3D42"); resp.Stopped != 1 {
+		t.Fatalf("the other tenant 42 run should be stopped, got %+v", resp)
+	}
+	<-reasons
+	<-done["r-2"]
+
+	if stopped := registry.StopMatching(StopFilter{Job: "re*"}, "drain"); stopped != 1 {
+		t.Fatalf("expected the last run to be stopped, stopped %d", stopped)
+	}
+	if resp := decodeReply(t, <-done["r-3"]); resp.StopReason != "drain" {
+		t.Fatalf("unexpected reply of the last run: %+v", resp)
+	}
+}
+
+func TestContextJobsAndPlainRuns(t *testing.T) {
+	registry := NewRegistry()
+	plainStarted, plainExit := make(chan struct{}), make(chan struct{})
+	if err := registry.AddJob("plain", func(map[string]string, string) bool {
+		close(plainStarted)
+		<-plainExit
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	started := make(chan string, 2)
+	if err := registry.AddContextJob("export", func(ctx context.Context, _ map[string]string, signature string) bool {
+		started <- signature
+		<-ctx.Done()
+		return false
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry))
+	run := func(ctx context.Context, job, signature string) <-chan *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/"+job, nil).WithContext(ctx)
+		req.Header.Set(base.RunSignature, signature)
+		return serveAsync(srv, req)
+	}
+
+	plainDone := run(context.Background(), "plain", "p-1")
+	<-plainStarted
+	if runs := registry.Runs("plain"); len(runs) != 1 || runs[0].Signature != "p-1" || runs[0].Stoppable {
+		t.Fatalf("the plain run should be listed as not stoppable, got %+v", runs)
+	}
+	stop := httptest.NewRequest(http.MethodGet, "/plain", nil)
+	stop.Header.Set(base.StopJobFlag, "true")
+	stop.Header.Set("Accept", base.JSONContentType)
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, stop)
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), base.NOT_STOPPABLE) {
+		t.Fatalf("stopping a plain job should be refused as not stoppable, got %d %s", rec.Code, rec.Body.String())
+	}
+	if stopped := registry.StopMatching(StopFilter{Job: "plain"}, ""); stopped != 0 {
+		t.Fatalf("filtered stops should skip plain runs, stopped %d", stopped)
+	}
+	close(plainExit)
+	if resp := decodeReply(t, <-plainDone); resp.Status != base.SUCCESS {
+		t.Fatalf("the plain run should finish, got %+v", resp)
+	}
+	if runs := registry.Runs("plain"); len(runs) != 0 {
+		t.Fatalf("the finished run should no longer be listed, got %+v", runs)
+	}
+
+	done := run(context.Background(), "export", "e-1")
+	<-started
+	if runs := registry.Runs("export"); len(runs) != 1 || !runs[0].Stoppable {
+		t.Fatalf("the context run should be listed as stoppable, got %+v", runs)
+	}
+	if !registry.stopWithReason("export", "e-1", "operator") {
+		t.Fatal("the context run should accept a stop")
+	}
+	if resp := decodeReply(t, <-done); resp.Status != base.INTERRUPT || resp.StopReason != "operator" {
+		t.Fatalf("the stopped run should be interrupted, got %+v", resp)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done = run(ctx, "export", "e-2")
+	<-started
+	cancel()
+	if resp := decodeReply(t, <-done); resp.Status != base.INTERRUPT || !strings.Contains(resp.StopReason, "caller went away") {
+		t.Fatalf("a run whose caller went away should be interrupted, got %+v", resp)
+	}
+}
+
+func TestStopReasonReachesEveryHandler(t *testing.T) {
+	registry := NewRegistry()
+	started, reasons := make(chan struct{}, 2), make(chan string, 2)
+	if err := registry.AddStoppableJob("stoppable", func(_ map[string]string, signature string, quit chan struct{}) bool {
+		started <- struct{}{}
+		<-quit
+		reasons <- registry.StopReason("stoppable", signature)
+		return false
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	if err := registry.AddContextJob("contextual", func(ctx context.Context, _ map[string]string, _ string) bool {
+		started <- struct{}{}
+		<-ctx.Done()
+		var stopped *StopError
+		if errors.As(context.Cause(ctx), &stopped) {
+			reasons <- stopped.Reason
+		} else {
+			reasons <- "cause: " + context.Cause(ctx).Error()
+		}
+		return false
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry))
+
+	for _, job := range []string{"stoppable", "contextual"} {
+		done := make(chan struct{})
+		go func(job string) {
+			req := httptest.NewRequest(http.MethodGet, "/"+job, nil)
+			req.Header.Set(base.RunSignature, "s-1")
+			srv.ServeHTTP(httptest.NewRecorder(), req)
+			close(done)
+		}(job)
+		<-started
+		if stopped := registry.StopMatching(StopFilter{Job: job}, "maintenance"); stopped != 1 {
+			t.Fatalf("%s: expected one run to be stopped, stopped %d", job, stopped)
+		}
+		if reason := <-reasons; reason != "maintenance" {
+			t.Fatalf("%s: the handler should get the stop reason, got %q", job, reason)
+		}
+		<-done
+	}
+	if reason := registry.StopReason("stoppable", "s-1"); reason != "" {
+		t.Fatalf("an ended run has no stop reason, got %q", reason)
+	}
+}
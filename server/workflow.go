@@ -0,0 +1,257 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/Kingson4Wu/saturncli/base"
+)
+
+// FailurePolicy decides what a workflow does after a step fails.
+type FailurePolicy int
+
+const (
+	// AbortOnFailure skips every step that has not started yet.
+	AbortOnFailure FailurePolicy = iota
+	// ContinueOnFailure keeps running steps that do not depend on the failed
+	// one; its dependents are skipped.
+	ContinueOnFailure
+)
+
+// WorkflowStep runs one registered job as part of a workflow.
+type WorkflowStep struct {
+	// Name identifies the step within the workflow; it defaults to Job.
+	Name string
+	// Job is the registered job the step runs.
+	Job string
+	// After lists the steps that must succeed before this one starts.
+	After []string
+	// Params are added to the workflow's own args for this step. A value may
+	// reference an earlier step listed in After, directly or transitively:
+	// ${step.key} expands to that step's output key and ${step.result} to
+	// its result value.
+	Params map[string]string
+}
+
+// Workflow is a set of steps run in dependency order, one at a time. A paused
+// workflow finishes its current step and waits before starting the next.
+type Workflow struct {
+	Steps     []WorkflowStep
+	OnFailure FailurePolicy
+}
+
+var stepReference = regexp.MustCompile(`\$\{([^.}]+)\.([^}]+)\}`)
+
+// AddWorkflow registers a workflow in the package-level registry.
+func AddWorkflow(name string, workflow Workflow, opts ...JobOption) error {
+	return defaultRegistry.AddWorkflow(name, workflow, opts...)
+}
+
+// AddWorkflow registers a workflow composed of already registered jobs. It
+// runs like any other job: by name, with args passed to every step, and a
+// stop request stops the running step and skips the rest. Steps run as the
+// workflow's caller: a step whose job the caller may not use fails, and the
+// step jobs' rate limits apply. The result value lists the outcome of every
+// step and the outputs are those of all steps, keyed step.key.
+func (r *Registry) AddWorkflow(name string, workflow Workflow, opts ...JobOption) error {
+	steps, err := r.planWorkflow(workflow.Steps)
+	if err != nil {
+		return fmt.Errorf("workflow %s: %w", name, err)
+	}
+	job := &notifyJob{name: name, workflow: &Workflow{Steps: steps, OnFailure: workflow.OnFailure}}
+	if err := r.registerJob(job, opts); err != nil {
+		return err
+	}
+	r.ensureRunningMap(name)
+	return nil
+}
+
+// planWorkflow validates steps and returns them in the order they will run:
+// each time, the first declared step whose dependencies have all run.
+func (r *Registry) planWorkflow(steps []WorkflowStep) ([]WorkflowStep, error) {
+	if len(steps) == 0 {
+		return nil, errors.New("no steps")
+	}
+	steps = append([]WorkflowStep(nil), steps...)
+	byName := make(map[string]int, len(steps))
+	for i, step := range steps {
+		if step.Name == "" {
+			step.Name = step.Job
+		}
+		if strings.TrimSpace(step.Name) == "" {
+			return nil, fmt.Errorf("step %d has no job", i+1)
+		}
+		if strings.ContainsAny(step.Name, ".{}") {
+			return nil, fmt.Errorf("step name %q must not contain '.', '{' or '}'", step.Name)
+		}
+		if _, ok := byName[step.Name]; ok {
+			return nil, fmt.Errorf("duplicate step %s", step.Name)
+		}
+		if _, ok := r.getJob(step.Job); !ok {
+			return nil, fmt.Errorf("step %s: job %s is not registered", step.Name, step.Job)
+		}
+		byName[step.Name] = i
+		steps[i] = step
+	}
+
+	ordered := make([]WorkflowStep, 0, len(steps))
+	placed := make(map[string]bool, len(steps))
+	for len(ordered) < len(steps) {
+		progressed := false
+		for _, step := range steps {
+			if placed[step.Name] {
+				continue
+			}
+			ready := true
+			for _, dep := range step.After {
+				if _, ok := byName[dep]; !ok {
+					return nil, fmt.Errorf("step %s: unknown dependency %s", step.Name, dep)
+				}
+				ready = ready && placed[dep]
+			}
+			if ready {
+				ordered = append(ordered, step)
+				placed[step.Name] = true
+				progressed = true
+				break
+			}
+		}
+		if !progressed {
+			return nil, errors.New("steps have a dependency cycle")
+		}
+	}
+
+	for _, step := range ordered {
+		ancestors := stepAncestors(step, steps, byName)
+		for _, value := range step.Params {
+			for _, ref := range stepReference.FindAllStringSubmatch(value, -1) {
+				if !ancestors[ref[1]] {
+					return nil, fmt.Errorf("step %s: %s does not refer to a step it runs after", step.Name, ref[0])
+				}
+			}
+		}
+	}
+	return ordered, nil
+}
+
+func stepAncestors(step WorkflowStep, steps []WorkflowStep, byName map[string]int) map[string]bool {
+	ancestors := map[string]bool{}
+	pending := append([]string(nil), step.After...)
+	for len(pending) > 0 {
+		name := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if ancestors[name] {
+			continue
+		}
+		ancestors[name] = true
+		pending = append(pending, steps[byName[name]].After...)
+	}
+	return ancestors
+}
+
+// runWorkflow executes the steps of workflow for req and reports whether all
+// of them succeeded.
+func (s *ser) runWorkflow(workflow *Workflow, req *JobRequest) bool {
+	results := make([]base.StepResult, 0, len(workflow.Steps))
+	responses := make(map[string]base.Response, len(workflow.Steps))
+	aborted := ""
+	for _, step := range workflow.Steps {
+		result := base.StepResult{Step: step.Name, Job: step.Job}
+		req.WaitIfPaused()
+		switch blocked := blockedBy(step, responses); {
+		case aborted != "":
+			result.Status, result.Message = base.SKIPPED, aborted
+		case isClosed(req.quit):
+			result.Status, result.Message = base.SKIPPED, "workflow was stopped"
+		case blocked != "":
+			result.Status, result.Message = base.SKIPPED, "dependency "+blocked+" did not succeed"
+		default:
+			resp := s.runStep(step, req, responses)
+			responses[step.Name] = resp
+			result.Signature, result.Status, result.Message = resp.Signature, resp.Status, resp.Message
+			for k, v := range resp.Outputs {
+				req.SetOutput(step.Name+"."+k, v)
+			}
+			if resp.Status != base.SUCCESS && workflow.OnFailure == AbortOnFailure {
+				aborted = "step " + step.Name + " did not succeed"
+			}
+		}
+		results = append(results, result)
+	}
+	if err := req.SetResult(results); err != nil {
+		s.logger.Errorf("saturn server workflow result failure, name:%s, err: %v", req.Name, err)
+	}
+	for _, result := range results {
+		if result.Status != base.SUCCESS {
+			return false
+		}
+	}
+	return true
+}
+
+// blockedBy names the first dependency of step that did not succeed.
+func blockedBy(step WorkflowStep, responses map[string]base.Response) string {
+	for _, dep := range step.After {
+		if responses[dep].Status != base.SUCCESS {
+			return dep
+		}
+	}
+	return ""
+}
+
+func (s *ser) runStep(step WorkflowStep, req *JobRequest, responses map[string]base.Response) base.Response {
+	signature := req.Signature + "." + step.Name
+	job, ok := s.registry.getJob(step.Job)
+	if !ok {
+		return base.Response{Status: base.NOT_EXIST, Job: step.Job, Signature: signature, Message: "job is not registered"}
+	}
+	args := make(map[string]string, len(req.Args)+len(step.Params))
+	for k, v := range req.Args {
+		args[k] = v
+	}
+	for k, v := range step.Params {
+		args[k] = expandStepReferences(v, responses)
+	}
+	values := url.Values{}
+	for k, v := range args {
+		values.Set(k, v)
+	}
+	if req.caller != nil && !s.registry.allows(step.Job, *req.caller) {
+		s.logger.Warnf("saturn server workflow step refused, name:%s, step: %s, uid: %d, pid: %d", req.Name, step.Name, req.caller.UID, req.caller.PID)
+		return base.Response{Status: base.FAILURE, Job: step.Job, Signature: signature, Message: "caller is not allowed to use this job"}
+	}
+	return s.execute(invocation{job: job, args: args, values: values, signature: signature, stop: req.quit, stopReason: req.StopReason, cancel: req.quit, caller: req.caller})
+}
+
+func expandStepReferences(value string, responses map[string]base.Response) string {
+	return stepReference.ReplaceAllStringFunc(value, func(ref string) string {
+		match := stepReference.FindStringSubmatch(ref)
+		resp := responses[match[1]]
+		if match[2] != "result" {
+			return resp.Outputs[match[2]]
+		}
+		return resultText(resp)
+	})
+}
+
+// resultText renders a step's result value for use in a parameter: text and
+// bytes as they were returned, JSON as its encoding.
+func resultText(resp base.Response) string {
+	switch resp.ResultType {
+	case base.ResultText:
+		var text string
+		if err := json.Unmarshal(resp.Result, &text); err == nil {
+			return text
+		}
+	case base.ResultBytes:
+		var data []byte
+		if err := json.Unmarshal(resp.Result, &data); err == nil {
+			return string(data)
+		}
+	}
+	return string(resp.Result)
+}
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Kingson4Wu/saturncli/base"
+	"github.com/Kingson4Wu/saturncli/utils"
+)
+
+func workflowSteps(t *testing.T, resp base.Response) []base.StepResult {
+	t.Helper()
+	var steps []base.StepResult
+	if err := json.Unmarshal(resp.Result, &steps); err != nil {
+		t.Fatalf("decode step results %q: %v", resp.Result, err)
+	}
+	return steps
+}
+
+func TestWorkflowPassesParamsBetweenSteps(t *testing.T) {
+	registry := NewRegistry()
+	if err := registry.AddRequestJob("export", func(req *JobRequest) bool {
+		req.SetOutput("path", "/tmp/"+req.Get("tenant")+".csv")
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	var transformed string
+	if err := registry.AddJob("transform", func(args map[string]string, signature string) bool {
+		transformed = args["input"] + "|" + args["tenant"]
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	if err := registry.AddJob("verify", func(args map[string]string, signature string) bool {
+		return false
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	if err := registry.AddJob("report", func(args map[string]string, signature string) bool {
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+
+	steps := []WorkflowStep{
+		{Job: "verify", After: []string{"transform"}},
+		{Job: "transform", After: []string{"export"}, Params: map[string]string{"input": "${export.path}"}},
+		{Job: "export"},
+		{Job: "report"},
+	}
+	if err := registry.AddWorkflow("nightly", Workflow{Steps: steps}); err != nil {
+		t.Fatalf("failed to add workflow: %v", err)
+	}
+	if err := registry.AddWorkflow("nightly-continue", Workflow{Steps: steps, OnFailure: ContinueOnFailure}); err != nil {
+		t.Fatalf("failed to add workflow: %v", err)
+	}
+
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry))
+	resp := serveJSON(t, srv, httptest.NewRequest(http.MethodGet, "/nightly?tenant=acme", nil))
+	if resp.Status != base.FAILURE || transformed != "/tmp/acme.csv|acme" || resp.Outputs["export.path"] != "/tmp/acme.csv" {
+		t.Fatalf("unexpected workflow reply %+v, transform saw %q", resp, transformed)
+	}
+	got := workflowSteps(t, resp)
+	want := []struct{ step, status string }{
+		{"export", base.SUCCESS}, {"transform", base.SUCCESS}, {"verify", base.FAILURE}, {"report", base.SKIPPED},
+	}
+	for i, w := range want {
+		if got[i].Step != w.step || got[i].Status != w.status {
+			t.Fatalf("step %d: expected %s %s, got %+v", i, w.step, w.status, got)
+		}
+	}
+	if got[0].Signature != resp.Signature+".export" {
+		t.Fatalf("expected step signature derived from the run, got %q", got[0].Signature)
+	}
+
+	resp = serveJSON(t, srv, httptest.NewRequest(http.MethodGet, "/nightly-continue", nil))
+	if got := workflowSteps(t, resp); resp.Status != base.FAILURE || got[3].Status != base.SUCCESS {
+		t.Fatalf("expected independent steps to keep running, got %+v", got)
+	}
+}
+
+func TestWorkflowStopCancelsRunningStep(t *testing.T) {
+	registry := NewRegistry()
+	started := make(chan struct{})
+	if err := registry.AddStoppableJob("backfill", func(args map[string]string, signature string, quit chan struct{}) bool {
+		close(started)
+		<-quit
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	if err := registry.AddJob("cleanup", func(args map[string]string, signature string) bool {
+		t.Error("cleanup should be skipped after a stop")
+		return true
+	}); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	if err := registry.AddWorkflow("maintenance", Workflow{Steps: []WorkflowStep{
+		{Job: "backfill"},
+		{Job: "cleanup", After: []string{"backfill"}},
+	}}); err != nil {
+		t.Fatalf("failed to add workflow: %v", err)
+	}
+
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry))
+	req := httptest.NewRequest(http.MethodGet, "/maintenance", nil)
+	req.Header.Set(base.RunSignature, "wf-1")
+	done := serveAsync(srv, req)
+	<-started
+
+	stop := httptest.NewRequest(http.MethodGet, "/maintenance", nil)
+	stop.Header.Set(base.StopJobFlag, "true")
+	stop.Header.Set(base.StopSignature, "wf-1")
+	if resp := serveJSON(t, srv, stop); resp.Status != base.SUCCESS {
+		t.Fatalf("stop failed: %+v", resp)
+	}
+
+	select {
+	case rec := <-done:
+		resp := decodeReply(t, rec)
+		steps := workflowSteps(t, resp)
+		if resp.Status != base.INTERRUPT || steps[0].Status != base.INTERRUPT || steps[1].Status != base.SKIPPED {
+			t.Fatalf("unexpected stopped workflow: %+v %+v", resp, steps)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("workflow did not stop")
+	}
+}
+
+func TestAddWorkflowValidates(t *testing.T) {
+	registry := NewRegistry()
+	if err := registry.AddJob("a", func(args map[string]string, signature string) bool { return true }); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	cases := map[string][]WorkflowStep{
+		"empty":       nil,
+		"unknown job": {{Job: "missing"}},
+		"duplicate":   {{Job: "a"}, {Job: "a"}},
+		"cycle":       {{Name: "x", Job: "a", After: []string{"y"}}, {Name: "y", Job: "a", After: []string{"x"}}},
+		"unknown dep": {{Job: "a", After: []string{"b"}}},
+		"bad ref":     {{Name: "x", Job: "a"}, {Name: "y", Job: "a", Params: map[string]string{"p": "${x.out}"}}},
+	}
+	for name, steps := range cases {
+		if err := registry.AddWorkflow("wf-"+name, Workflow{Steps: steps}); err == nil {
+			t.Errorf("%s: expected registration to fail", name)
+		}
+	}
+}
+
+func TestWorkflowStepsRunAsCaller(t *testing.T) {
+	registry := NewRegistry()
+	ok := func(map[string]string, string) bool { return true }
+	billing := registry.Group("billing")
+	if err := billing.AddJob("charge", ok); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	billing.SetACL(AllowUIDs(8))
+	if err := registry.AddJob("report", ok, WithCallerRateLimit(time.Hour, 1)); err != nil {
+		t.Fatalf("failed to add job: %v", err)
+	}
+	if err := registry.AddWorkflow("nightly", Workflow{Steps: []WorkflowStep{{Name: "charge", Job: "billing.charge"}}}); err != nil {
+		t.Fatalf("failed to add workflow: %v", err)
+	}
+	if err := registry.AddWorkflow("reports", Workflow{Steps: []WorkflowStep{{Job: "report"}}}); err != nil {
+		t.Fatalf("failed to add workflow: %v", err)
+	}
+	srv := NewServer(&utils.DefaultLogger{}, "", WithRegistry(registry))
+	run := func(caller Caller, workflow string) (base.Response, base.StepResult) {
+		resp := serveJSON(t, srv, withCaller(httptest.NewRequest(http.MethodGet, "/"+workflow, nil), caller))
+		return resp, workflowSteps(t, resp)[0]
+	}
+
+	if resp, step := run(Caller{}, "nightly"); resp.Status != base.FAILURE || step.Status != base.FAILURE || step.Message != "caller is not allowed to use this job" {
+		t.Fatalf("a step the caller may not use should fail, got %+v %+v", resp, step)
+	}
+	if resp, _ := run(Caller{UID: 8, Known: true}, "nightly"); resp.Status != base.SUCCESS {
+		t.Fatalf("an allowed caller should run the step, got %+v", resp)
+	}
+
+	if resp, _ := run(Caller{UID: 1000, Known: true}, "reports"); resp.Status != base.SUCCESS {
+		t.Fatalf("the first run should fit in the step's limit, got %+v", resp)
+	}
+	if _, step := run(Caller{UID: 1000, Known: true}, "reports"); step.Status != base.RATE_LIMITED {
+		t.Fatalf("the step should count against the caller's limit, got %+v", step)
+	}
+	if resp, _ := run(Caller{UID: 1001, Known: true}, "reports"); resp.Status != base.SUCCESS {
+		t.Fatalf("another caller has its own limit, got %+v", resp)
+	}
+}